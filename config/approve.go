@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Approve stops the run until a person approves it, such as before deleting a cluster or cutting over DNS.
+type Approve struct {
+	// Name is the unique name of the Approve sequence.
+	Name string
+	// Approve is a summary of what is being approved, which is shown when asking for approval. This can contain
+	// template variables that reference keys stored in our val map.
+	Approve string
+
+	// SeqOptions lets an Approve be selected with Tags and skipped with When, the same as the steps it guards.
+	// It cannot have ContinueOnError.
+	SeqOptions
+}
+
+func (a *Approve) Sequence() string {
+	return a.Name
+}
+
+func (a *Approve) validate(seen map[string]bool) error {
+	a.Name = strings.TrimSpace(a.Name)
+	if a.Name == "" {
+		return errors.New("an Approve cannot have an empty name field")
+	}
+	if _, ok := seen[a.Name]; ok {
+		return fmt.Errorf("Approve(%s) was defined multiple times", a.Name)
+	}
+	seen[a.Name] = true
+
+	if a.ContinueOnError {
+		return fmt.Errorf("Approve(%s) cannot have ContinueOnError, a step that is not approved always stops the run", a.Name)
+	}
+	if strings.TrimSpace(a.Approve) == "" {
+		return fmt.Errorf("Approve(%s) had an empty Approve field", a.Name)
+	}
+	if _, err := template.New("").Parse(a.Approve); err != nil {
+		return fmt.Errorf("Approve(%s) violated a text/template rule: %s", a.Name, err)
+	}
+	return nil
+}
+
+// Summary returns the summary of what is being approved, with template variables substituted from "vals".
+func (a *Approve) Summary(vals map[string]string) (string, error) {
+	tmpl, err := template.New("").Parse(a.Approve)
+	if err != nil {
+		return "", fmt.Errorf("Approve(%s) violated a text/template rule: %s", a.Name, err)
+	}
+	b := strings.Builder{}
+	if err := tmpl.Execute(&b, TemplateData(vals)); err != nil {
+		return "", fmt.Errorf("Approve(%s): problem with template execution: %s", a.Name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
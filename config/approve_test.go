@@ -0,0 +1,114 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestApprove(t *testing.T) {
+	tests := []struct {
+		desc        string
+		content     string
+		want        *Approve
+		wantSummary string
+		wantErr     bool
+	}{
+		{
+			desc: "Approve",
+			content: `
+[[Seqs]]
+	Name = "Create"
+	Cmd = "az aks create"
+
+[[Seqs]]
+	Name = "ApproveDelete"
+	Approve = """
+	Delete cluster {{ .Cluster }}
+	"""
+`,
+			want:        &Approve{Name: "ApproveDelete", Approve: "\tDelete cluster {{ .Cluster }}\n\t"},
+			wantSummary: "Delete cluster old",
+		},
+		{
+			desc: "Tags and When",
+			content: `
+[[Seqs]]
+	Name = "Create"
+	Cmd = "az aks create"
+
+[[Seqs]]
+	Name = "ApproveDelete"
+	Approve = "Delete cluster {{ .Cluster }}"
+	Tags = ["cleanup"]
+	When = "{{ .Cluster }}"
+`,
+			want: &Approve{
+				Name:       "ApproveDelete",
+				Approve:    "Delete cluster {{ .Cluster }}",
+				SeqOptions: SeqOptions{Tags: []string{"cleanup"}, When: "{{ .Cluster }}"},
+			},
+			wantSummary: "Delete cluster old",
+		},
+		{
+			desc: "ContinueOnError",
+			content: `
+[[Seqs]]
+	Name = "Create"
+	Cmd = "az aks create"
+
+[[Seqs]]
+	Name = "ApproveDelete"
+	Approve = "Delete cluster {{ .Cluster }}"
+	ContinueOnError = true
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Empty summary",
+			content: `
+[[Seqs]]
+	Name = "Create"
+	Cmd = "az aks create"
+
+[[Seqs]]
+	Name = "ApproveDelete"
+	Approve = " "
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Bad template",
+			content: `
+[[Seqs]]
+	Name = "Create"
+	Cmd = "az aks create"
+
+[[Seqs]]
+	Name = "ApproveDelete"
+	Approve = "Delete {{ .Cluster"
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, ok := readContent(t, test.desc, test.content, test.wantErr)
+		if !ok {
+			continue
+		}
+
+		a := got.Sequences()[1].approve
+		if diff := pretty.Compare(test.want, a); diff != "" {
+			t.Errorf("TestApprove(%s): -want/+got:\n%s", test.desc, diff)
+		}
+		summary, err := a.Summary(map[string]string{"Cluster": "old"})
+		if err != nil {
+			t.Errorf("TestApprove(%s): Summary got err == %s", test.desc, err)
+			continue
+		}
+		if summary != test.wantSummary {
+			t.Errorf("TestApprove(%s): got summary %q, want %q", test.desc, summary, test.wantSummary)
+		}
+	}
+}
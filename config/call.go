@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Call runs another config as a nested sequence. The Sequences of the called config are named
+// "[Call.Name]/[Sequence name]" when reporting failures, which allows resuming inside the called config.
+type Call struct {
+	// Name is the unique name of the Call sequence.
+	Name string
+	// Config is the path to the config to run. Unless it is absolute, this is relative to the directory of the file
+	// that holds the Call.
+	Config string
+	// Vals are the values passed to the called config, keyed by the name in its Required. Values can contain
+	// template variables that reference keys stored in our val map.
+	Vals map[string]string
+	// Outputs maps keys in our val map to keys in the called config's val map. When the called config
+	// finishes, each value is copied into our val map.
+	Outputs map[string]string
+
+	SeqOptions
+
+	config *Config
+}
+
+func (c *Call) Sequence() string {
+	return c.Name
+}
+
+// Child returns the Config that is called.
+func (c *Call) Child() *Config {
+	return c.config
+}
+
+func (c *Call) validate(seen map[string]bool) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return errors.New("a Call cannot have an empty name field")
+	}
+	if _, ok := seen[c.Name]; ok {
+		return fmt.Errorf("Call(%s) was defined multiple times", c.Name)
+	}
+	seen[c.Name] = true
+
+	if c.config == nil {
+		return fmt.Errorf("bug: Call(%s) config(%s) was never loaded", c.Name, c.Config)
+	}
+	for k := range c.Vals {
+		if _, ok := c.config.required[k]; !ok {
+			return fmt.Errorf("Call(%s) passes value(%s) that is not in the Required of config(%s)", c.Name, k, c.Config)
+		}
+	}
+	for _, req := range c.config.Required {
+		if _, ok := c.Vals[req.Name]; !ok && req.Default == "" {
+			return fmt.Errorf("Call(%s) must pass value(%s) required by config(%s)", c.Name, req.Name, c.Config)
+		}
+	}
+	for k, v := range c.Outputs {
+		if strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
+			return fmt.Errorf("Call(%s) cannot have an Output with an empty key or value", c.Name)
+		}
+	}
+	return nil
+}
+
+// ChildVals returns the vals to pass to the called config by executing the templates in Vals
+// against "vals".
+func (c *Call) ChildVals(vals map[string]string) (map[string]string, error) {
+	child := make(map[string]string, len(c.Vals))
+	for k, v := range c.Vals {
+		tmpl, err := template.New("").Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("Call(%s) value(%s) violated a text/template rule: %s", c.Name, k, err)
+		}
+		b := strings.Builder{}
+		if err := tmpl.Execute(&b, TemplateData(vals)); err != nil {
+			return nil, fmt.Errorf("Call(%s) value(%s): problem with template execution: %s", c.Name, k, err)
+		}
+		child[k] = b.String()
+	}
+	return child, nil
+}
+
+// Output copies the values listed in Outputs from "child" to "vals".
+func (c *Call) Output(child, vals map[string]string) error {
+	for k, ck := range c.Outputs {
+		v, ok := child[ck]
+		if !ok {
+			return fmt.Errorf("Call(%s) output(%s) was not set by config(%s)", c.Name, ck, c.Config)
+		}
+		vals[k] = v
+	}
+	return nil
+}
+
+// resolve makes any paths in the Sequence relative to the config file at "p" that holds it.
+func (s *Sequence) resolve(p string) {
+	s.each(func(s *Sequence) error {
+		if s.call != nil {
+			s.call.Config = resolvePath(p, s.call.Config)
+		}
+		return nil
+	})
+}
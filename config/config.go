@@ -1,18 +1,20 @@
-// Package config holds our basic translation from a TOML configuration file to a usable struct.
+// Package config holds our basic translation from a TOML, YAML or JSON configuration file to a usable struct.
 package config
 
 import (
-	"log"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
+	"log"
+	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	gfs "github.com/gopherfs/fs"
 	//"github.com/silas/dag"
 )
@@ -21,15 +23,31 @@ import (
 type Config struct {
 	// Required are required values that must be passed in.
 	Required []Required
+	// Include is a list of other configuration files whose Required, CreateVars, Macros and Seqs
+	// are added before this file's. Paths that are not absolute are relative to the directory of this file.
+	Include []string
+	// Macros are named templates of Seqs that can be used in Seqs of this file or any file that includes it.
+	Macros []*Macro
 	// CreateVars are a list of variables to create. This operation is done before any
 	// sequence has run, but it does allow use of variables stored in the vals map.
 	CreateVars []*CreateVar
-	// Sequences is a sequence of actions to execute, in order.
-	//Seqs []Sequence
-
-	Seqs []toml.Primitive
+	// Env are environment variables set for every Runner. Values can contain template variables that
+	// reference keys stored in our val map. The Env of included files is added, with this file's values
+	// replacing any with the same name.
+	Env map[string]string
+	// InheritEnv is which of runme's environment variables are passed to every Runner. See InheritEnv on Runner.
+	// If not set, the InheritEnv of the last included file that sets it is used.
+	InheritEnv []string
+	// Seqs is a sequence of actions to execute, in order. The kind of each action is determined by its keys.
+	Seqs []map[string]interface{}
+	// Finally is a sequence of actions that are always run after Seqs, whether they succeeded or failed, such as
+	// to delete temporary files or log out. It is not run when the run stops for approval or is quit, as the resumed
+	// run needs what it tears down. A failure here does not stop the rest of Finally and does not change where a
+	// resumed run starts.
+	Finally []map[string]interface{}
 
 	sequences []*Sequence
+	finally   []*Sequence
 	required  map[string]*regexp.Regexp
 }
 
@@ -42,8 +60,28 @@ func (c *Config) Sequences() []*Sequence {
 	return c.sequences
 }
 
-// validate validates all the Runners.
-func (c *Config) validate(fsys gfs.Writer, vals map[string]string) error {
+// IsSecret returns true if the value stored at key "k" was marked as a Secret in Required.
+func (c *Config) IsSecret(k string) bool {
+	for _, req := range c.Required {
+		if req.Name == k {
+			return req.Secret
+		}
+	}
+	return false
+}
+
+// Redact replaces any values in "s" that are the value of a Secret in "vals" with "[redacted]".
+func (c *Config) Redact(vals map[string]string, s string) string {
+	for k, v := range vals {
+		if v != "" && c.IsSecret(k) {
+			s = strings.ReplaceAll(s, v, "[redacted]")
+		}
+	}
+	return s
+}
+
+// validate validates all the Runners. This does not validate any values, which is done in Setup().
+func (c *Config) validate() error {
 	if len(c.sequences) == 0 {
 		return fmt.Errorf("no valid Sequences defined")
 	}
@@ -53,6 +91,9 @@ func (c *Config) validate(fsys gfs.Writer, vals map[string]string) error {
 		if _, ok := c.required[req.Name]; ok {
 			return fmt.Errorf("a Required field(%s) was set twice", req.Name)
 		}
+		if reserved(req.Name) {
+			return fmt.Errorf("a Required field cannot be named %s, which is reserved", req.Name)
+		}
 		var re *regexp.Regexp
 		var err error
 		if req.Regex == "" {
@@ -66,21 +107,8 @@ func (c *Config) validate(fsys gfs.Writer, vals map[string]string) error {
 		c.required[req.Name] = re
 	}
 
-	if len(c.required) != len(vals) {
-		return fmt.Errorf("there are %d values required, but only saw %d passed", len(c.required), len(vals))
-	}
-
-	for k, v := range vals {
-		re, ok := c.required[k]
-		if !ok {
-			return fmt.Errorf("value passed with key(%s) that was not found in config.Required", k)
-		}
-		if re == nil {
-			continue
-		}
-		if !re.MatchString(v) {
-			return fmt.Errorf("value passed with key(%s) did not have a valid value(%s)", k, v)
-		}
+	if err := validateEnv(c.Env, c.InheritEnv); err != nil {
+		return err
 	}
 
 	seen := map[string]bool{}
@@ -89,31 +117,38 @@ func (c *Config) validate(fsys gfs.Writer, vals map[string]string) error {
 		if err := v.validate(seen); err != nil {
 			return err
 		}
-		if err := v.Exec(fsys, vals); err != nil {
-			return err
-		}
 	}
 
 	runners := 0
+	for _, seq := range c.sequences {
+		switch seq.Item().(type) {
+		case *Runner, *Call:
+			runners++
+		}
+	}
 
-	for i, seq := range c.sequences {
+	for _, seq := range c.allSequences() {
 		switch v := seq.Item().(type) {
 		case *CreateVar:
 			if err := v.validate(seen); err != nil {
 				return err
 			}
-			c.sequences[i] = &Sequence{createVar: v}
 		case *Runner:
-			runners++
 			if err := v.validate(seen); err != nil {
 				return err
 			}
-			c.sequences[i] = &Sequence{runner: v}
 		case *WriteFile:
 			if err := v.validate(seen); err != nil {
 				return err
 			}
-			c.sequences[i] = &Sequence{writeFile: v}
+		case *Call:
+			if err := v.validate(seen); err != nil {
+				return err
+			}
+		case *Approve:
+			if err := v.validate(seen); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("Sequence is a type(%T) that is not recognized: ", seq)
 		}
@@ -124,20 +159,124 @@ func (c *Config) validate(fsys gfs.Writer, vals map[string]string) error {
 	return nil
 }
 
+// Setup validates "vals" against Required, adds any Default values that were not passed and
+// executes CreateVars, which store their values in "vals". A value may also be passed for a key that a step in
+// Seqs sets, which is needed when that step is not run. FromFile() calls this for you.
+func (c *Config) Setup(fsys gfs.Writer, vals map[string]string) error {
+	missing := []Required{}
+	for _, req := range c.Required {
+		if _, ok := vals[req.Name]; ok {
+			continue
+		}
+		if req.Default == "" {
+			missing = append(missing, req)
+		}
+	}
+	if len(missing) > 0 {
+		return &MissingError{Required: missing}
+	}
+	for _, req := range c.Required {
+		if _, ok := vals[req.Name]; !ok {
+			vals[req.Name] = req.Default
+		}
+	}
+
+	set := map[string]bool{}
+	for _, s := range c.sequences {
+		for _, k := range s.Defines() {
+			set[k] = true
+		}
+	}
+	for k, v := range vals {
+		if k == WorkspaceKey {
+			continue
+		}
+		re, ok := c.required[k]
+		if !ok {
+			if set[k] {
+				continue
+			}
+			return fmt.Errorf("value passed with key(%s) that was not found in config.Required or set by a step", k)
+		}
+		if re == nil {
+			continue
+		}
+		if !re.MatchString(v) {
+			if c.IsSecret(k) {
+				return fmt.Errorf("value passed with key(%s) did not have a valid value", k)
+			}
+			return fmt.Errorf("value passed with key(%s) did not have a valid value(%s)", k, v)
+		}
+	}
+
+	for _, v := range c.CreateVars {
+		if err := v.Exec(fsys, vals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Required is a required value that must be passed in before anything is executed.
 type Required struct {
 	// Name is the name of the value that must be passed.
 	Name string
+	// Description describes the value. This is shown when prompting for the value.
+	Description string
+	// Default is the value used if one is not passed. If set, the value is no longer
+	// required to be passed.
+	Default string
 	// Regex is the regexp.Regexp that must match for the value to be valid.
 	// If not set, the value is not checked.
 	Regex string
+	// Secret indicates the value is sensitive. Input is hidden when prompting and the
+	// value is never printed.
+	Secret bool
+}
+
+// Validate validates that "v" is a valid value for this Required.
+func (r Required) Validate(v string) error {
+	if r.Regex == "" {
+		return nil
+	}
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return fmt.Errorf("a Required field(%s) had an invalid regex: %s", r.Name, r.Regex)
+	}
+	if !re.MatchString(v) {
+		return fmt.Errorf("value for key(%s) must match regex(%s)", r.Name, r.Regex)
+	}
+	return nil
+}
+
+// MissingError is returned by FromFile when values listed in Config.Required were not passed
+// and do not have a Default.
+type MissingError struct {
+	// Required are the Required entries that were not passed.
+	Required []Required
 }
 
-// Sequence represents a sequenced action to perform. This is either a CreateVar, Runner or WriteFile.
+func (m *MissingError) Error() string {
+	names := make([]string, 0, len(m.Required))
+	for _, req := range m.Required {
+		names = append(names, req.Name)
+	}
+	return fmt.Sprintf("missing required values: %s", strings.Join(names, ", "))
+}
+
+// Sequence represents a sequenced action to perform. This is either a CreateVar, Runner, WriteFile, Call or Approve.
 type Sequence struct {
 	createVar *CreateVar
 	runner    *Runner
 	writeFile *WriteFile
+	call      *Call
+	approve   *Approve
+
+	// useMacro is only set while loading. It is replaced by the Macro's Sequences.
+	useMacro *UseMacro
+
+	// onFailure are the Sequences decoded from the OnFailure of the item.
+	onFailure []*Sequence
 }
 
 func (s *Sequence) Item() interface{} {
@@ -150,6 +289,15 @@ func (s *Sequence) Item() interface{} {
 	if s.writeFile != nil {
 		return s.writeFile
 	}
+	if s.call != nil {
+		return s.call
+	}
+	if s.approve != nil {
+		return s.approve
+	}
+	if s.useMacro != nil {
+		return s.useMacro
+	}
 	return nil
 }
 
@@ -181,6 +329,9 @@ func (c *CreateVar) validate(seen map[string]bool) error {
 	if strings.TrimSpace(c.Key) != c.Key {
 		return fmt.Errorf("CreateVar cannot have key(%s): has leading or trailing space", c.Key)
 	}
+	if reserved(c.Key) {
+		return fmt.Errorf("CreateVar(%s) cannot have key(%s), which is reserved", c.Name, c.Key)
+	}
 	return nil
 }
 
@@ -190,7 +341,7 @@ func (c *CreateVar) Exec(fsys fs.FS, vals map[string]string) error {
 		return fmt.Errorf("CreateVar(%s) violated a text/template rule: %s", c.Key, err)
 	}
 	b := strings.Builder{}
-	if err := tmpl.Execute(&b, vals); err != nil {
+	if err := tmpl.Execute(&b, TemplateData(vals)); err != nil {
 		return fmt.Errorf("CreateVar(%s): problem with template execution: %s", c.Key, err)
 	}
 	vals[c.Key] = b.String()
@@ -201,11 +352,17 @@ func (c *CreateVar) Exec(fsys fs.FS, vals map[string]string) error {
 type WriteFile struct {
 	// Name is the unique name of the CreateVar sequence.
 	Name string
-	// Path is where to store the file.
+	// Path is where to store the file. A relative Path is relative to WorkDir.
 	Path string
+	// WorkDir is the directory a relative Path is in, which is created if it doesn't exist. This can contain
+	// template variables. A relative WorkDir is relative to the Workspace. If not set, this is the Workspace if
+	// there is one or else the current directory.
+	WorkDir string
 	// Value is the value to write to the file. This can contain template variables that reference keys
 	// stored in our val map.
 	Value string
+
+	SeqOptions
 }
 
 func (w *WriteFile) Sequence() string {
@@ -239,11 +396,27 @@ func (w *WriteFile) Exec(wr gfs.Writer, vals map[string]string) error {
 		return fmt.Errorf("WriteFile(%s) violated a text/template rule: %s", w.Path, err)
 	}
 	b := bytes.Buffer{}
-	if err := tmpl.Execute(&b, vals); err != nil {
+	if err := tmpl.Execute(&b, TemplateData(vals)); err != nil {
 		return fmt.Errorf("WriteFile(%s): problem with template execution: %s", w.Path, err)
 	}
 
-	if err := wr.WriteFile(w.Path, b.Bytes(), 0600); err != nil {
+	dir, err := WorkDir(w.WorkDir, vals)
+	if err != nil {
+		return fmt.Errorf("WriteFile(%s): %s", w.Path, err)
+	}
+	p := w.Path
+	if dir != "" {
+		if mk, ok := wr.(gfs.MkdirAllFS); ok {
+			if err := mk.MkdirAll(dir, 0700); err != nil {
+				return fmt.Errorf("WriteFile(%s): could not create WorkDir: %s", w.Path, err)
+			}
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+	}
+
+	if err := wr.WriteFile(p, b.Bytes(), 0600); err != nil {
 		return fmt.Errorf("WriteFile(%s): %s", w.Path, err)
 	}
 	return nil
@@ -259,22 +432,148 @@ func (d *duration) UnmarshalText(text []byte) error {
 	return err
 }
 
+// size is a number of bytes, which is written as a number with an optional unit such as "512KiB" or "10MB".
+type size struct {
+	Bytes int64
+}
+
+// sizeUnits are the units a size can have.
+var sizeUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// UnmarshalJSON allows a size to be a JSON number of bytes, which is how TOML and YAML integers such as
+// "MaxOutput = 1024" reach us, as well as a string.
+func (s *size) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '"' {
+		var text string
+		if err := json.Unmarshal(b, &text); err != nil {
+			return err
+		}
+		return s.UnmarshalText([]byte(text))
+	}
+	return s.UnmarshalText(b)
+}
+
+func (s *size) UnmarshalText(text []byte) error {
+	t := strings.TrimSpace(string(text))
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(t, u.suffix) {
+			t = strings.TrimSpace(strings.TrimSuffix(t, u.suffix))
+			mult = u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("size(%s) must be a positive number with an optional unit of B, KB, KiB, MB, MiB, GB or GiB", text)
+	}
+	s.Bytes = n * mult
+	return nil
+}
+
 // Runner represents a runner node in the DAG.
 type Runner struct {
 	// Name is the name of this Runner. (Required)
 	Name string
 	// Cmd is the command to execute. You may use {{.KeyName}} for value substitution that comes from the passed
-	// map. All "\n" and "\" characters are turned into spaces before parsing. (Required)
+	// map. All "\n" and "\" characters are turned into spaces before parsing, unless Shell is set. (Required unless
+	// Pipeline or Func is set)
 	Cmd string
+	// Shell runs Cmd as a script with this shell, which must be "bash" or "sh". This allows pipes and redirection.
+	// Values output by templates are quoted so the shell sees each as a single word, use {{ raw .KeyName }} to
+	// output a value unquoted.
+	Shell string
+	// Pipeline is a list of commands that are run with the stdout of each connected to the stdin of the next, without
+	// a shell. Each is written the same way as Cmd. This cannot be used with Cmd.
+	Pipeline []string
+	// Func is the name of a Go function registered with the Executor, which is run instead of a command. This is for
+	// binaries built with the exec package. Its outputs are the stdout of the Runner as a JSON object and its error is
+	// the stderr. This cannot be used with Cmd, Shell, Pipeline, Undo or the settings for how a command is run.
+	Func string
+	// Outputs maps keys in our val map to the names of outputs of Func, whose values are stored there when it succeeds.
+	// Only used with Func.
+	Outputs map[string]string
 	// Sleep indicates the amount of time to sleep before executing this command.
 	Sleep duration
 	// Retries is the number of retries to attempt if this fails. Failure is marked with any non-0 return code.
 	Retries int
-	// RetrySleep is the time to sleep between retries.
+	// RetrySleep is the time to sleep between retries. With an exponential Backoff, this is the time to sleep before
+	// the first retry.
 	RetrySleep duration
+	// Backoff is how the sleep between retries changes, "constant" (the default) or "exponential". With "exponential",
+	// each sleep is the one before it times Multiplier.
+	Backoff string
+	// Multiplier is what each sleep is multiplied by with an exponential Backoff. Defaults to 2.
+	Multiplier float64
+	// MaxSleep is the longest sleep between retries.
+	MaxSleep duration
+	// Jitter randomly increases each sleep by up to this fraction of it, which must be between 0 and 1.
+	Jitter float64
+	// RetryOn, if set, only retries failures that match it. Other failures fail the Runner.
+	RetryOn *RetryCond
+	// NoRetryOn fails the Runner without retrying on failures that match it, even if they match RetryOn.
+	NoRetryOn *RetryCond
+	// Expect are checks on the stdout of the command after it succeeds. If one fails, the Runner fails and can be retried.
+	Expect []*Expect
+	// WaitUntil re-runs the command until its output satisfies a condition, for things that take time to become
+	// true such as a new identity propagating. This cannot be used with Retries.
+	WaitUntil *WaitUntil
 	// ValueKey is the unique key to store the STDOUT of this command in. This value will have TrimSpace() called on it
 	// before it is stored.
 	ValueKey string
+	// StderrKey is the key to store the STDERR of this command in. This value will have TrimSpace() called on it
+	// before it is stored.
+	StderrKey string
+	// ExitCodeKey is the key to store the exit code of this command in.
+	ExitCodeKey string
+	// AllowedExitCodes are non-zero exit codes that do not fail this Runner.
+	AllowedExitCodes []int
+	// MaxOutput is the most of the STDOUT and of the STDERR that is kept, such as "1MiB" or a number of bytes. If not set,
+	// all output is kept.
+	MaxOutput size
+	// OnMaxOutput is what happens when the output is larger than MaxOutput. "truncate" (the default) keeps the start of the
+	// output. "fail" fails the Runner. "spill" writes the output to a file in the Workspace and stores the path of the file
+	// at ValueKey or StderrKey instead of the output.
+	OnMaxOutput string
+	// WorkDir is the directory the command is run in, which is created if it doesn't exist. This can contain template
+	// variables. A relative WorkDir is relative to the Workspace. If not set, this is the Workspace if there is one or
+	// else the current directory.
+	WorkDir string
+	// Stdin is sent to the stdin of the command. This can contain template variables that reference keys stored in our
+	// val map.
+	Stdin string
+	// StdinFrom sends the value stored at this key in our val map to the stdin of the command. If there is no such key, this
+	// is the path of a file whose content is sent instead. A relative path is relative to WorkDir. This cannot be used with Stdin.
+	StdinFrom string
+	// Env are environment variables set for this Runner. These are added to the Config's Env, replacing any with the same
+	// name. Values can contain template variables that reference keys stored in our val map.
+	Env map[string]string
+	// InheritEnv is which of runme's environment variables are passed to this command, which replaces the Config's InheritEnv.
+	// Each entry is "none", "base" (GOPATH, HOME and PATH), "all" or the name of a variable, which can be a glob such as
+	// "AZURE_*". If not set by the Runner or Config, this is "base".
+	InheritEnv []string
+	// Undo is a command that reverses what this Runner did, such as "az group delete -n {{ .Resc }} --yes". It is run by
+	// "runme rollback" with the vals as they were when this Runner completed. It is run the same way as Cmd, with the same
+	// Shell, WorkDir and Env. This cannot be used with Func.
+	Undo string
+	// Interactive runs the command in a pseudo-terminal connected to runme's terminal, so that the user can answer
+	// prompts. A transcript of the session is written to the output directory of the Workspace and the output is stored at
+	// ValueKey. runme must be run from a terminal. This cannot be used with Pipeline, Stdin, StdinFrom or StderrKey.
+	Interactive bool
+
+	SeqOptions
 }
 
 func (r *Runner) Sequence() string {
@@ -288,17 +587,82 @@ func (r *Runner) validate(seen map[string]bool) error {
 	}
 
 	r.Cmd = strings.TrimSpace(r.Cmd)
-	if r.Cmd == "" {
+	switch {
+	case r.Func != "":
+		if err := r.validateFunc(); err != nil {
+			return err
+		}
+	case r.Outputs != nil:
+		return fmt.Errorf("Runner(%s) cannot have Outputs without Func", r.Name)
+	case r.Pipeline != nil:
+		if r.Cmd != "" {
+			return fmt.Errorf("Runner(%s) cannot have both Cmd and Pipeline", r.Name)
+		}
+		if r.Shell != "" {
+			return fmt.Errorf("Runner(%s) cannot have both Shell and Pipeline", r.Name)
+		}
+		if len(r.Pipeline) == 0 {
+			return fmt.Errorf("Runner(%s) had an empty Pipeline field", r.Name)
+		}
+		for i, stage := range r.Pipeline {
+			r.Pipeline[i] = joinLines(stage)
+			if r.Pipeline[i] == "" {
+				return fmt.Errorf("Runner(%s) had an empty Pipeline stage(%d)", r.Name, i)
+			}
+		}
+	case r.Cmd == "":
 		return fmt.Errorf("Runner(%s) had an empty Cmd field", r.Name)
+	case r.Shell != "":
+		switch r.Shell {
+		case "bash", "sh":
+		default:
+			return fmt.Errorf("Runner(%s) had Shell(%s), which must be bash or sh", r.Name, r.Shell)
+		}
+	default:
+		r.Cmd = joinLines(r.Cmd)
+	}
+	if r.Shell == "" {
+		r.Undo = joinLines(r.Undo)
+	} else {
+		r.Undo = strings.TrimSpace(r.Undo)
+	}
+
+	r.StdinFrom = strings.TrimSpace(r.StdinFrom)
+	if r.Stdin != "" && r.StdinFrom != "" {
+		return fmt.Errorf("Runner(%s) cannot have both Stdin and StdinFrom", r.Name)
+	}
+	if r.Interactive {
+		switch {
+		case r.Pipeline != nil:
+			return fmt.Errorf("Runner(%s) cannot have both Interactive and Pipeline", r.Name)
+		case r.Stdin != "" || r.StdinFrom != "":
+			return fmt.Errorf("Runner(%s) cannot have Interactive with Stdin or StdinFrom", r.Name)
+		case r.StderrKey != "":
+			return fmt.Errorf("Runner(%s) cannot have Interactive with StderrKey, stderr is part of the output", r.Name)
+		}
 	}
-	lines := strings.Split(r.Cmd, "\n")
-	for i := range lines {
-		lines[i] = strings.TrimSpace(lines[i])
-		lines[i] = strings.TrimPrefix(lines[i], "\t")
-		lines[i] = strings.TrimPrefix(lines[i], `\t`)
-		lines[i] = strings.TrimSuffix(lines[i], `\`)
+	keys := map[string]string{"ValueKey": r.ValueKey, "StderrKey": r.StderrKey, "ExitCodeKey": r.ExitCodeKey}
+	for field, k := range keys {
+		if reserved(k) {
+			return fmt.Errorf("Runner(%s) cannot have %s(%s), which is reserved", r.Name, field, k)
+		}
+	}
+	switch r.OnMaxOutput {
+	case "", "truncate", "fail", "spill":
+	default:
+		return fmt.Errorf("Runner(%s) had OnMaxOutput(%s), which must be truncate, fail or spill", r.Name, r.OnMaxOutput)
+	}
+	if r.OnMaxOutput != "" && r.MaxOutput.Bytes == 0 {
+		return fmt.Errorf("Runner(%s) had OnMaxOutput set without MaxOutput", r.Name)
+	}
+	for _, code := range r.AllowedExitCodes {
+		if code < 1 || code > 255 {
+			return fmt.Errorf("Runner(%s) had AllowedExitCodes entry(%d), which must be between 1 and 255", r.Name, code)
+		}
+	}
+	if err := validateEnv(r.Env, r.InheritEnv); err != nil {
+		return fmt.Errorf("Runner(%s): %w", r.Name, err)
 	}
-	r.Cmd = strings.Join(lines, " ")
 
 	if _, ok := seen[r.Name]; ok {
 		return fmt.Errorf("Runner(%s) was defined multiple times", r.Name)
@@ -308,72 +672,50 @@ func (r *Runner) validate(seen map[string]bool) error {
 	if r.Sleep.Duration > 30*time.Minute {
 		return fmt.Errorf("Runner(%s) had a Sleep time of %s which exceeds the 30 minute maximum", r.Name, r.Sleep)
 	}
-	if r.Retries > 100 || r.Retries < 0 {
-		return fmt.Errorf("Runner(%s) had a Retries setting of %d, which exceeds the 100 maximum or is less than 0", r.Name, r.Retries)
+	for i, x := range r.Expect {
+		if err := x.validate(); err != nil {
+			return fmt.Errorf("Runner(%s) Expect(%d): %w", r.Name, i, err)
+		}
 	}
-	retrySleepMax := duration{time.Duration(r.Retries) * r.RetrySleep.Duration}
-	if retrySleepMax.Duration > 30*time.Minute {
-		return fmt.Errorf("Runner(%s) had a Retries + RetrySleep that could take %s, which exceeds our 30 minute limit", r.Name, retrySleepMax)
+	if r.WaitUntil != nil {
+		switch {
+		case r.Retries > 0:
+			return fmt.Errorf("Runner(%s) cannot have both WaitUntil and Retries", r.Name)
+		case r.Interactive:
+			return fmt.Errorf("Runner(%s) cannot have both WaitUntil and Interactive", r.Name)
+		}
+		if err := r.WaitUntil.validate(); err != nil {
+			return fmt.Errorf("Runner(%s): %w", r.Name, err)
+		}
 	}
-	return nil
+	return r.validateRetry()
+}
+
+// joinLines joins a multi-line command into a single line. "runme fmt" uses it too, so that a formatted Cmd runs the
+// same command.
+func joinLines(cmd string) string {
+	lines := strings.Split(strings.TrimSpace(cmd), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+		lines[i] = strings.TrimPrefix(lines[i], "\t")
+		lines[i] = strings.TrimPrefix(lines[i], `\t`)
+		lines[i] = strings.TrimSuffix(lines[i], `\`)
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, " ")
 }
 
 // FromFile returns a Config from a file "p" in filesystem "fsys". This validates all the runners are correct, that all nodes referenced
-// are present and validates that we have a valid DAG.
+// are present and validates that we have a valid DAG. Files listed in Include are loaded relative to "p" and Macros
+// are expanded before validation.
 func FromFile(fsys gfs.Writer, p string, vals map[string]string) (*Config, error) {
-	b, err := fs.ReadFile(fsys, p)
-	if err != nil {
-		return nil, err
-	}
-	c := &Config{}
-	md, err := toml.Decode(string(b), c)
+	c, err := newLoader(fsys, map[string]bool{}).config(p)
 	if err != nil {
 		return nil, err
 	}
 
-	for i, seq := range c.Seqs {
-		s := &Sequence{}
-		cv := CreateVar{}
-		if err := md.PrimitiveDecode(seq, &cv); err == nil {
-			// PrimitiveDecode will decode a Runner into a CreateVar because both have
-			// the Attribute "Name". You can't get a metadata for just this to check if the keys
-			// have been decoded. So, we check that a unique and required attribute is set.
-			if cv.Key != "" {
-				s.createVar = &cv
-				c.sequences = append(c.sequences, s)
-				continue
-			}
-		}
-		r := Runner{}
-		if err := md.PrimitiveDecode(seq, &r); err == nil {
-			if r.Cmd != "" {
-				s.runner = &r
-				c.sequences = append(c.sequences, s)
-				continue
-			}
-		}
-		wf := WriteFile{}
-		if err := md.PrimitiveDecode(seq, &wf); err == nil{
-			if wf.Path != "" {
-				s.writeFile = &wf
-				c.sequences = append(c.sequences, s)
-				continue
-			}
-		}
-		return nil, fmt.Errorf("Sequence(%d) does not seem to decode into anything", i)
-	}
-
-	if err := c.validate(fsys, vals); err != nil {
+	if err := c.Setup(fsys, vals); err != nil {
 		return nil, err
 	}
-
-	if len(md.Undecoded()) > 0 {
-		keys := []string{}
-		for _, tk := range md.Undecoded() {
-			keys = append(keys, tk.String())
-		}
-		return nil, fmt.Errorf("had unknown keys: %s", strings.Join(keys, ", "))
-	}
-
 	return c, nil
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"embed"
+	"errors"
 	"regexp"
 	"strings"
 	"testing"
@@ -254,3 +255,731 @@ func mapHas(t *testing.T, vals map[string]string, name string, value string) {
 		t.Errorf("vals map key(%s): got %q, want %q", name, vals[name], value)
 	}
 }
+
+// writeFiles returns a file system holding "files", which maps paths to their content.
+func writeFiles(t *testing.T, files map[string]string) *simple.FS {
+	t.Helper()
+
+	wfs := simple.New()
+	for p, content := range files {
+		if err := wfs.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatalf("could not write file(%s): %s", p, err)
+		}
+	}
+	return wfs
+}
+
+// readConfig reads the config at "p" in "wfs" with "vals" for the test case "desc" and reports an error if FromFile
+// did not fail when "wantErr" is set or failed when it isn't. It only returns true when the Config can be checked.
+func readConfig(t *testing.T, desc string, wfs *simple.FS, p string, vals map[string]string, wantErr bool) (*Config, bool) {
+	t.Helper()
+
+	if vals == nil {
+		vals = map[string]string{}
+	}
+	c, err := FromFile(wfs, p, vals)
+	switch {
+	case err == nil && wantErr:
+		t.Errorf("%s(%s): got err == nil, want err != nil", t.Name(), desc)
+		return nil, false
+	case err != nil && !wantErr:
+		t.Errorf("%s(%s): got err == %s, want err == nil", t.Name(), desc, err)
+		return nil, false
+	case err != nil:
+		return nil, false
+	}
+	return c, true
+}
+
+// readContent is readConfig for a config.toml holding "content" and no vals.
+func readContent(t *testing.T, desc string, content string, wantErr bool) (*Config, bool) {
+	t.Helper()
+
+	return readConfig(t, desc, writeFiles(t, map[string]string{"config.toml": content}), "config.toml", nil, wantErr)
+}
+
+func TestRequired(t *testing.T) {
+	conf := `
+[[Required]]
+	Name = "Region"
+	Regex = "^[a-z0-9]+$"
+[[Required]]
+	Name = "Size"
+	Default = "small"
+[[Required]]
+	Name = "Password"
+	Secret = true
+
+[[Seqs]]
+	Name = "Echo"
+	Cmd = "echo {{ .Region }}"
+`
+
+	tests := []struct {
+		desc        string
+		vals        map[string]string
+		wantMissing []string
+		wantErr     bool
+		wantVals    map[string]string
+	}{
+		{
+			desc:        "Missing values without defaults",
+			vals:        map[string]string{"Size": "large"},
+			wantMissing: []string{"Region", "Password"},
+		},
+		{
+			desc:    "Value fails regex",
+			vals:    map[string]string{"Region": "West US", "Password": "pass"},
+			wantErr: true,
+		},
+		{
+			desc:     "Default is used",
+			vals:     map[string]string{"Region": "westus", "Password": "pass"},
+			wantVals: map[string]string{"Region": "westus", "Size": "small", "Password": "pass"},
+		},
+	}
+
+	for _, test := range tests {
+		wfs := simple.New()
+		if err := wfs.WriteFile("config.toml", []byte(conf), 0600); err != nil {
+			panic(err)
+		}
+
+		_, err := FromFile(wfs, "config.toml", test.vals)
+		switch {
+		case test.wantMissing != nil:
+			missing := &MissingError{}
+			if !errors.As(err, &missing) {
+				t.Errorf("TestRequired(%s): got err == %v, want *MissingError", test.desc, err)
+				continue
+			}
+			got := []string{}
+			for _, req := range missing.Required {
+				got = append(got, req.Name)
+			}
+			if diff := pretty.Compare(test.wantMissing, got); diff != "" {
+				t.Errorf("TestRequired(%s): -want/+got:\n%s", test.desc, diff)
+			}
+			continue
+		case err == nil && test.wantErr:
+			t.Errorf("TestRequired(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestRequired(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		if diff := pretty.Compare(test.wantVals, test.vals); diff != "" {
+			t.Errorf("TestRequired(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestInclude(t *testing.T) {
+	login := `
+[[Required]]
+	Name = "Subscription"
+
+[[Macros]]
+	Name = "Login"
+	Params = ["Sub"]
+	[[Macros.Seqs]]
+		Name = "AzLogin"
+		Cmd = "az login --use-device-code"
+	[[Macros.Seqs]]
+		Name = "SetAccount"
+		Cmd = "az account set -s {% .Sub %}"
+`
+
+	tests := []struct {
+		desc    string
+		files   map[string]string
+		want    []*Sequence
+		wantErr bool
+	}{
+		{
+			desc: "Include with Macro used twice",
+			files: map[string]string{
+				"common/login.toml": login,
+				"deploy/config.toml": `
+Include = ["../common/login.toml"]
+
+[[Seqs]]
+	Name = "Prod"
+	Macro = "Login"
+	[Seqs.Params]
+		Sub = "{{ .Subscription }}"
+
+[[Seqs]]
+	Name = "Dev"
+	Macro = "Login"
+	[Seqs.Params]
+		Sub = "dev"
+`,
+			},
+			want: []*Sequence{
+				{runner: &Runner{Name: "Prod/AzLogin", Cmd: "az login --use-device-code"}},
+				{runner: &Runner{Name: "Prod/SetAccount", Cmd: "az account set -s {{ .Subscription }}"}},
+				{runner: &Runner{Name: "Dev/AzLogin", Cmd: "az login --use-device-code"}},
+				{runner: &Runner{Name: "Dev/SetAccount", Cmd: "az account set -s dev"}},
+			},
+		},
+		{
+			desc: "Absolute Include",
+			files: map[string]string{
+				"/common/login.toml": login,
+				"deploy/config.toml": `
+Include = ["/common/login.toml"]
+
+[[Seqs]]
+	Name = "Dev"
+	Macro = "Login"
+	[Seqs.Params]
+		Sub = "dev"
+`,
+			},
+			want: []*Sequence{
+				{runner: &Runner{Name: "Dev/AzLogin", Cmd: "az login --use-device-code"}},
+				{runner: &Runner{Name: "Dev/SetAccount", Cmd: "az account set -s dev"}},
+			},
+		},
+		{
+			desc: "Macro defined in two files",
+			files: map[string]string{
+				"common/login.toml":  login,
+				"common/login2.toml": login,
+				"deploy/config.toml": `
+Include = ["../common/login.toml", "../common/login2.toml"]
+
+[[Seqs]]
+	Name = "Prod"
+	Macro = "Login"
+	[Seqs.Params]
+		Sub = "prod"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Missing Macro parameter",
+			files: map[string]string{
+				"common/login.toml": login,
+				"deploy/config.toml": `
+Include = ["../common/login.toml"]
+
+[[Seqs]]
+	Name = "Prod"
+	Macro = "Login"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Include cycle",
+			files: map[string]string{
+				"common/a.toml": `Include = ["../deploy/config.toml"]`,
+				"deploy/config.toml": `
+Include = ["../common/a.toml"]
+
+[[Seqs]]
+	Name = "Echo"
+	Cmd = "echo hello"
+`,
+			},
+			wantErr: true,
+		},
+	}
+
+	pconf := pretty.Config{
+		Diffable:          true,
+		IncludeUnexported: true,
+		SkipZeroFields:    true,
+	}
+
+	for _, test := range tests {
+		got, ok := readConfig(t, test.desc, writeFiles(t, test.files), "deploy/config.toml", map[string]string{"Subscription": "sub"}, test.wantErr)
+		if !ok {
+			continue
+		}
+
+		if diff := pconf.Compare(test.want, got.Sequences()); diff != "" {
+			t.Errorf("TestInclude(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestIncludeEnv(t *testing.T) {
+	common := `
+Env = { REGION = "westus", TIER = "dev" }
+InheritEnv = ["all"]
+`
+
+	tests := []struct {
+		desc           string
+		config         string
+		wantEnv        map[string]string
+		wantInheritEnv []string
+	}{
+		{
+			desc:           "Included Env and InheritEnv are used",
+			config:         `Include = ["common.toml"]`,
+			wantEnv:        map[string]string{"REGION": "westus", "TIER": "dev"},
+			wantInheritEnv: []string{"all"},
+		},
+		{
+			desc: "Our Env and InheritEnv win",
+			config: `
+Include = ["common.toml"]
+Env = { TIER = "prod" }
+InheritEnv = ["none"]
+`,
+			wantEnv:        map[string]string{"REGION": "westus", "TIER": "prod"},
+			wantInheritEnv: []string{"none"},
+		},
+	}
+
+	for _, test := range tests {
+		wfs := writeFiles(t, map[string]string{
+			"common.toml": common,
+			"config.toml": test.config + `
+[[Seqs]]
+	Name = "Echo"
+	Cmd = "echo"
+`,
+		})
+		got, ok := readConfig(t, test.desc, wfs, "config.toml", nil, false)
+		if !ok {
+			continue
+		}
+		if diff := pretty.Compare(test.wantEnv, got.Env); diff != "" {
+			t.Errorf("TestIncludeEnv(%s): Env: -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantInheritEnv, got.InheritEnv); diff != "" {
+			t.Errorf("TestIncludeEnv(%s): InheritEnv: -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	child := `
+[[Required]]
+	Name = "Region"
+
+[[Seqs]]
+	Name = "CreateCluster"
+	Cmd = "az aks create --location {{ .Region }}"
+	ValueKey = "ClusterInfo"
+`
+
+	tests := []struct {
+		desc       string
+		parent     string
+		wantConfig string
+		wantErr    bool
+	}{
+		{
+			desc: "Valid Call",
+			parent: `
+[[Seqs]]
+	Name = "Cluster"
+	Config = "cluster/config.toml"
+	[Seqs.Vals]
+		Region = "{{ .Region }}"
+	[Seqs.Outputs]
+		ClusterInfo = "ClusterInfo"
+`,
+			wantConfig: "stamp/cluster/config.toml",
+		},
+		{
+			desc: "Absolute Call",
+			parent: `
+[[Seqs]]
+	Name = "Cluster"
+	Config = "/shared/cluster.toml"
+	[Seqs.Vals]
+		Region = "{{ .Region }}"
+`,
+			wantConfig: "/shared/cluster.toml",
+		},
+		{
+			desc: "Call missing a Required value",
+			parent: `
+[[Seqs]]
+	Name = "Cluster"
+	Config = "cluster/config.toml"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Call passes unknown value",
+			parent: `
+[[Seqs]]
+	Name = "Cluster"
+	Config = "cluster/config.toml"
+	[Seqs.Vals]
+		Region = "{{ .Region }}"
+		Zone = "1"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Call cycle",
+			parent: `
+[[Seqs]]
+	Name = "Self"
+	Config = "config.toml"
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		wfs := writeFiles(t, map[string]string{
+			"stamp/cluster/config.toml": child,
+			"/shared/cluster.toml":      child,
+			"stamp/config.toml": `
+[[Required]]
+	Name = "Region"
+` + test.parent,
+		})
+		got, ok := readConfig(t, test.desc, wfs, "stamp/config.toml", map[string]string{"Region": "westus"}, test.wantErr)
+		if !ok {
+			continue
+		}
+
+		call := got.Sequences()[0].Item().(*Call)
+		if call.Config != test.wantConfig {
+			t.Errorf("TestCall(%s): got Config == %s, want %s", test.desc, call.Config, test.wantConfig)
+		}
+		childVals, err := call.ChildVals(map[string]string{"Region": "westus"})
+		if err != nil {
+			t.Errorf("TestCall(%s): ChildVals() got err == %s", test.desc, err)
+			continue
+		}
+		if err := call.Child().Setup(wfs, childVals); err != nil {
+			t.Errorf("TestCall(%s): Setup() got err == %s", test.desc, err)
+			continue
+		}
+		mapHas(t, childVals, "Region", "westus")
+	}
+}
+
+func TestFormats(t *testing.T) {
+	want := []*Sequence{
+		{runner: &Runner{Name: "SetAccount", Cmd: "az account set -s {{ .Subscription }}", Retries: 2, RetrySleep: duration{30 * time.Second}}},
+		{writeFile: &WriteFile{Name: "Write Account", Path: "./account.txt", Value: "{{ .Subscription }}"}},
+	}
+
+	tests := []struct {
+		desc    string
+		path    string
+		content string
+		wantErr bool
+	}{
+		{
+			desc: "TOML",
+			path: "config.toml",
+			content: `
+[[Required]]
+	Name = "Subscription"
+
+[[Seqs]]
+	Name = "SetAccount"
+	Cmd = "az account set -s {{ .Subscription }}"
+	Retries = 2
+	RetrySleep = "30s"
+
+[[Seqs]]
+	Name = "Write Account"
+	Path = "./account.txt"
+	Value = "{{ .Subscription }}"
+`,
+		},
+		{
+			desc: "YAML",
+			path: "config.yaml",
+			content: `
+Required:
+  - Name: Subscription
+Seqs:
+  - Name: SetAccount
+    Cmd: az account set -s {{ .Subscription }}
+    Retries: 2
+    RetrySleep: 30s
+  - Name: Write Account
+    Path: ./account.txt
+    Value: "{{ .Subscription }}"
+`,
+		},
+		{
+			desc: "JSON",
+			path: "config.json",
+			content: `{
+	"Required": [{"Name": "Subscription"}],
+	"Seqs": [
+		{"Name": "SetAccount", "Cmd": "az account set -s {{ .Subscription }}", "Retries": 2, "RetrySleep": "30s"},
+		{"Name": "Write Account", "Path": "./account.txt", "Value": "{{ .Subscription }}"}
+	]
+}`,
+		},
+		{
+			desc: "Unknown key",
+			path: "config.yaml",
+			content: `
+Required:
+  - Name: Subscription
+Seqs:
+  - Name: SetAccount
+    Cmd: az account set -s {{ .Subscription }}
+    Retry: 2
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Keys for different kinds",
+			path: "config.json",
+			content: `{
+	"Required": [{"Name": "Subscription"}],
+	"Seqs": [
+		{"Name": "SetAccount", "Cmd": "az account set -s {{ .Subscription }}", "Path": "./account.txt"}
+	]
+}`,
+			wantErr: true,
+		},
+	}
+
+	pconf := pretty.Config{
+		Diffable:          true,
+		IncludeUnexported: true,
+		SkipZeroFields:    true,
+	}
+
+	for _, test := range tests {
+		wfs := writeFiles(t, map[string]string{test.path: test.content})
+		got, ok := readConfig(t, test.desc, wfs, test.path, map[string]string{"Subscription": "sub"}, test.wantErr)
+		if !ok {
+			continue
+		}
+
+		if diff := pconf.Compare(want, got.Sequences()); diff != "" {
+			t.Errorf("TestFormats(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestRunnerShellAndPipeline(t *testing.T) {
+	tests := []struct {
+		desc    string
+		content string
+		want    *Runner
+		wantErr bool
+	}{
+		{
+			desc: "Shell keeps lines",
+			content: `
+[[Seqs]]
+	Name = "Script"
+	Shell = "bash"
+	Cmd = """
+	kubectl get pods | grep foo
+	echo done > out.txt
+	"""
+`,
+			want: &Runner{Name: "Script", Shell: "bash", Cmd: "kubectl get pods | grep foo\n\techo done > out.txt"},
+		},
+		{
+			desc: "Pipeline",
+			content: `
+[[Seqs]]
+	Name = "Pods"
+	Pipeline = ["kubectl get pods", """grep
+		foo"""]
+`,
+			want: &Runner{Name: "Pods", Pipeline: []string{"kubectl get pods", "grep foo"}},
+		},
+		{
+			desc: "Undo",
+			content: `
+[[Seqs]]
+	Name = "CreateGroup"
+	Cmd = "az group create -n {{ .Resc }}"
+	Undo = """az group delete
+		-n {{ .Resc }} --yes"""
+`,
+			want: &Runner{Name: "CreateGroup", Cmd: "az group create -n {{ .Resc }}", Undo: "az group delete -n {{ .Resc }} --yes"},
+		},
+		{
+			desc: "Unknown Shell",
+			content: `
+[[Seqs]]
+	Name = "Script"
+	Shell = "zsh"
+	Cmd = "ls"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Cmd and Pipeline",
+			content: `
+[[Seqs]]
+	Name = "Pods"
+	Cmd = "ls"
+	Pipeline = ["kubectl get pods", "grep foo"]
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Shell and Pipeline",
+			content: `
+[[Seqs]]
+	Name = "Pods"
+	Shell = "sh"
+	Pipeline = ["kubectl get pods", "grep foo"]
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Empty Pipeline stage",
+			content: `
+[[Seqs]]
+	Name = "Pods"
+	Pipeline = ["kubectl get pods", " "]
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, ok := readContent(t, test.desc, test.content, test.wantErr)
+		if !ok {
+			continue
+		}
+
+		if diff := pretty.Compare(test.want, got.Sequences()[0].runner); diff != "" {
+			t.Errorf("TestRunnerShellAndPipeline(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    int64
+		wantErr bool
+	}{
+		{text: "1024", want: 1024},
+		{text: "10B", want: 10},
+		{text: "512KiB", want: 512 << 10},
+		{text: "2 MiB", want: 2 << 20},
+		{text: "1GiB", want: 1 << 30},
+		{text: "3KB", want: 3000},
+		{text: "1MB", want: 1000 * 1000},
+		{text: "1GB", want: 1000 * 1000 * 1000},
+		{text: "MiB", wantErr: true},
+		{text: "-1", wantErr: true},
+		{text: "1TiB", wantErr: true},
+	}
+
+	for _, test := range tests {
+		s := size{}
+		err := s.UnmarshalText([]byte(test.text))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestSize(%s): got err == nil, want err != nil", test.text)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestSize(%s): got err == %s, want err == nil", test.text, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if s.Bytes != test.want {
+			t.Errorf("TestSize(%s): got %d, want %d", test.text, s.Bytes, test.want)
+		}
+	}
+}
+
+func TestMaxOutput(t *testing.T) {
+	tests := []struct {
+		desc    string
+		path    string
+		content string
+		want    int64
+		wantErr bool
+	}{
+		{
+			desc: "TOML string",
+			path: "config.toml",
+			content: `
+[[Seqs]]
+	Name = "List"
+	Cmd = "ls"
+	MaxOutput = "1KiB"
+`,
+			want: 1 << 10,
+		},
+		{
+			desc: "TOML integer",
+			path: "config.toml",
+			content: `
+[[Seqs]]
+	Name = "List"
+	Cmd = "ls"
+	MaxOutput = 1024
+`,
+			want: 1024,
+		},
+		{
+			desc: "YAML integer",
+			path: "config.yaml",
+			content: `
+Seqs:
+  - Name: List
+    Cmd: ls
+    MaxOutput: 2048
+`,
+			want: 2048,
+		},
+		{
+			desc:    "JSON integer",
+			path:    "config.json",
+			content: `{"Seqs": [{"Name": "List", "Cmd": "ls", "MaxOutput": 4096}]}`,
+			want:    4096,
+		},
+		{
+			desc: "Fraction",
+			path: "config.toml",
+			content: `
+[[Seqs]]
+	Name = "List"
+	Cmd = "ls"
+	MaxOutput = 1.5
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Negative",
+			path: "config.toml",
+			content: `
+[[Seqs]]
+	Name = "List"
+	Cmd = "ls"
+	MaxOutput = -1
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		wfs := writeFiles(t, map[string]string{test.path: test.content})
+		got, ok := readConfig(t, test.desc, wfs, test.path, nil, test.wantErr)
+		if !ok {
+			continue
+		}
+		if b := got.Sequences()[0].runner.MaxOutput.Bytes; b != test.want {
+			t.Errorf("TestMaxOutput(%s): got %d bytes, want %d", test.desc, b, test.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of a config file.
+type Format string
+
+const (
+	// TOML is a config written in TOML. This is used for any file that doesn't have a
+	// .yaml, .yml or .json extension.
+	TOML Format = "toml"
+	// YAML is a config written in YAML.
+	YAML Format = "yaml"
+	// JSON is a config written in JSON.
+	JSON Format = "json"
+)
+
+// FormatOf returns the Format of the config file at "p" based on its extension.
+func FormatOf(p string) Format {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".yaml", ".yml":
+		return YAML
+	case ".json":
+		return JSON
+	}
+	return TOML
+}
+
+// decodeConfig decodes "b", which is in Format "f", into a Config. All formats are decoded into a
+// generic map first and then into the Config, so that they all follow the same rules.
+func decodeConfig(f Format, b []byte) (*Config, error) {
+	m := map[string]interface{}{}
+	switch f {
+	case TOML:
+		if _, err := toml.Decode(string(b), &m); err != nil {
+			return nil, err
+		}
+	case YAML:
+		if err := yaml.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+	case JSON:
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format(%s)", f)
+	}
+
+	c := &Config{}
+	if err := decodeMap(m, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// decodeMap decodes the generic map "m" into "v". Keys in "m" that are not fields of "v" are an error.
+func decodeMap(m map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// seqKind is a kind of entry in Seqs.
+type seqKind struct {
+	// key is the key that identifies an entry as this kind. No other kind may have this key, but a kind
+	// may be listed more than once with different keys.
+	key string
+	// typ is the type the entry is decoded into.
+	typ reflect.Type
+}
+
+// seqKinds are all the kinds of entries that can be in Seqs.
+var seqKinds = []seqKind{
+	{key: "Key", typ: reflect.TypeOf(CreateVar{})},
+	{key: "Cmd", typ: reflect.TypeOf(Runner{})},
+	{key: "Pipeline", typ: reflect.TypeOf(Runner{})},
+	{key: "Func", typ: reflect.TypeOf(Runner{})},
+	{key: "Path", typ: reflect.TypeOf(WriteFile{})},
+	{key: "Config", typ: reflect.TypeOf(Call{})},
+	{key: "Approve", typ: reflect.TypeOf(Approve{})},
+	{key: "Macro", typ: reflect.TypeOf(UseMacro{})},
+}
+
+// decodeSeq decodes a single entry of Seqs. The kind of entry is determined by which of the
+// seqKinds keys it has.
+func decodeSeq(m map[string]interface{}) (*Sequence, error) {
+	var kind *seqKind
+	found := []string{}
+	types := map[reflect.Type]bool{}
+	for i, k := range seqKinds {
+		if _, ok := m[k.key]; ok {
+			kind = &seqKinds[i]
+			found = append(found, k.key)
+			types[k.typ] = true
+		}
+	}
+	switch len(types) {
+	case 0:
+		keys := make([]string, 0, len(seqKinds))
+		for _, k := range seqKinds {
+			keys = append(keys, k.key)
+		}
+		return nil, fmt.Errorf("does not seem to decode into anything, must have one of these keys: %s", strings.Join(keys, ", "))
+	case 1:
+	default:
+		sort.Strings(found)
+		return nil, fmt.Errorf("has keys(%s) that are for different kinds of Sequences", strings.Join(found, ", "))
+	}
+
+	item := reflect.New(kind.typ).Interface()
+	if err := decodeMap(m, item); err != nil {
+		return nil, fmt.Errorf("could not be decoded into a %s: %s", kind.typ.Name(), err)
+	}
+	s := &Sequence{}
+	if err := s.set(item); err != nil {
+		return nil, err
+	}
+	if err := s.decodeOptions(item); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// set sets the item held by the Sequence.
+func (s *Sequence) set(item interface{}) error {
+	switch v := item.(type) {
+	case *CreateVar:
+		s.createVar = v
+	case *Runner:
+		s.runner = v
+	case *WriteFile:
+		s.writeFile = v
+	case *Call:
+		s.call = v
+	case *Approve:
+		s.approve = v
+	case *UseMacro:
+		s.useMacro = v
+	default:
+		return fmt.Errorf("Sequence is a type(%T) that is not recognized", item)
+	}
+	return nil
+}
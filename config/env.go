@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// baseEnv are the variables that are inherited by the "base" InheritEnv policy.
+var baseEnv = []string{"GOPATH", "HOME", "PATH"}
+
+// validateEnv validates an Env table and InheritEnv list.
+func validateEnv(env map[string]string, inherit []string) error {
+	for k := range env {
+		if k == "" || strings.ContainsAny(k, "=\x00") {
+			return fmt.Errorf("Env key(%s) is not a valid environment variable name", k)
+		}
+	}
+	for _, p := range inherit {
+		switch p {
+		case "none":
+			if len(inherit) > 1 {
+				return fmt.Errorf(`InheritEnv cannot have "none" with other entries`)
+			}
+		case "base", "all":
+		default:
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("InheritEnv has a bad pattern(%s): %s", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Environ returns the environment that Runner "r" is run with. "environ" is runme's own environment in the
+// form returned by os.Environ(), which is filtered by InheritEnv. The Config's Env and then the Runner's Env are
+// added after their templates are executed with "vals". "set" holds the variables that came from the Env tables.
+func (c *Config) Environ(r *Runner, vals map[string]string, environ []string) (env []string, set map[string]string, err error) {
+	inherit := r.InheritEnv
+	if inherit == nil {
+		inherit = c.InheritEnv
+	}
+	if inherit == nil {
+		inherit = []string{"base"}
+	}
+
+	vars := map[string]string{}
+	order := []string{}
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i == -1 {
+			continue
+		}
+		k, v := kv[:i], kv[i+1:]
+		if !inherits(inherit, k) {
+			continue
+		}
+		if _, ok := vars[k]; !ok {
+			order = append(order, k)
+		}
+		vars[k] = v
+	}
+
+	set = map[string]string{}
+	for _, table := range []map[string]string{c.Env, r.Env} {
+		for k, v := range table {
+			tmpl, err := template.New("").Parse(v)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Env(%s) violated a text/template rule: %s", k, err)
+			}
+			b := strings.Builder{}
+			if err := tmpl.Execute(&b, TemplateData(vals)); err != nil {
+				return nil, nil, fmt.Errorf("Env(%s): problem with template execution: %s", k, err)
+			}
+			set[k] = b.String()
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := vars[k]; !ok {
+			order = append(order, k)
+		}
+		vars[k] = set[k]
+	}
+
+	env = make([]string, 0, len(order))
+	for _, k := range order {
+		env = append(env, k+"="+vars[k])
+	}
+	return env, set, nil
+}
+
+// inherits returns true if the variable "k" is passed to a command with the InheritEnv "inherit".
+func inherits(inherit []string, k string) bool {
+	for _, p := range inherit {
+		switch p {
+		case "none":
+			return false
+		case "all":
+			return true
+		case "base":
+			for _, b := range baseEnv {
+				if k == b {
+					return true
+				}
+			}
+		default:
+			if ok, _ := path.Match(p, k); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestEnviron(t *testing.T) {
+	environ := []string{
+		"HOME=/home/me",
+		"PATH=/bin",
+		"AZURE_CONFIG_DIR=/az",
+		"AZURE_TENANT=tenant",
+		"KUBECONFIG=/kube",
+		"SHELL=/bin/bash",
+	}
+	vals := map[string]string{"Cluster": "prod"}
+
+	tests := []struct {
+		desc    string
+		conf    *Config
+		runner  *Runner
+		want    []string
+		wantSet map[string]string
+		wantErr bool
+	}{
+		{
+			desc:    "Default is base",
+			conf:    &Config{},
+			runner:  &Runner{},
+			want:    []string{"HOME=/home/me", "PATH=/bin"},
+			wantSet: map[string]string{},
+		},
+		{
+			desc:    "None",
+			conf:    &Config{InheritEnv: []string{"none"}},
+			runner:  &Runner{},
+			want:    []string{},
+			wantSet: map[string]string{},
+		},
+		{
+			desc:    "All",
+			conf:    &Config{InheritEnv: []string{"all"}},
+			runner:  &Runner{},
+			want:    environ,
+			wantSet: map[string]string{},
+		},
+		{
+			desc:    "Base and globs",
+			conf:    &Config{},
+			runner:  &Runner{InheritEnv: []string{"base", "AZURE_*", "KUBECONFIG"}},
+			want:    []string{"HOME=/home/me", "PATH=/bin", "AZURE_CONFIG_DIR=/az", "AZURE_TENANT=tenant", "KUBECONFIG=/kube"},
+			wantSet: map[string]string{},
+		},
+		{
+			desc:    "Runner InheritEnv replaces Config InheritEnv",
+			conf:    &Config{InheritEnv: []string{"all"}},
+			runner:  &Runner{InheritEnv: []string{"KUBECONFIG"}},
+			want:    []string{"KUBECONFIG=/kube"},
+			wantSet: map[string]string{},
+		},
+		{
+			desc: "Env tables with templates",
+			conf: &Config{
+				Env: map[string]string{"KUBECONFIG": "/kube/{{ .Cluster }}", "A": "config"},
+			},
+			runner: &Runner{Env: map[string]string{"A": "runner", "B": "b"}},
+			want:   []string{"HOME=/home/me", "PATH=/bin", "A=runner", "B=b", "KUBECONFIG=/kube/prod"},
+			wantSet: map[string]string{
+				"A":          "runner",
+				"B":          "b",
+				"KUBECONFIG": "/kube/prod",
+			},
+		},
+		{
+			desc:    "Bad template",
+			conf:    &Config{},
+			runner:  &Runner{Env: map[string]string{"A": "{{ .Cluster"}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, gotSet, err := test.conf.Environ(test.runner, vals, environ)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestEnviron(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestEnviron(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		if diff := pretty.Compare(test.want, got); diff != "" {
+			t.Errorf("TestEnviron(%s): env -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantSet, gotSet); diff != "" {
+			t.Errorf("TestEnviron(%s): set -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	tests := []struct {
+		desc    string
+		env     map[string]string
+		inherit []string
+		wantErr bool
+	}{
+		{desc: "Valid", env: map[string]string{"A": "b"}, inherit: []string{"base", "AZURE_*"}},
+		{desc: "Key with =", env: map[string]string{"A=B": "b"}, wantErr: true},
+		{desc: "none with others", inherit: []string{"none", "base"}, wantErr: true},
+		{desc: "Bad glob", inherit: []string{"AZURE_["}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := validateEnv(test.env, test.inherit)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestValidateEnv(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestValidateEnv(%s): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/element-of-surprise/runme/internal/jsonpath"
+)
+
+// Expect is a check on the stdout of a Runner's command after it succeeds. If any check set fails, the
+// Runner fails, which can be retried. String values can contain template variables that reference keys
+// stored in our val map.
+type Expect struct {
+	// JSONPath is the path of a value in the stdout of the command, which must be JSON, such as
+	// "$.properties.provisioningState". If set, the checks are made against this value instead of the whole stdout.
+	JSONPath string
+	// Contains checks that the value contains this.
+	Contains string
+	// Regex checks that the value matches this regex.
+	Regex string
+	// Equals checks that the value equals this.
+	Equals string
+	// In checks that the value equals one of these.
+	In []string
+	// GreaterThan checks that the value is a number greater than this.
+	GreaterThan *float64
+	// AtLeast checks that the value is a number greater than or equal to this.
+	AtLeast *float64
+	// LessThan checks that the value is a number less than this.
+	LessThan *float64
+	// AtMost checks that the value is a number less than or equal to this.
+	AtMost *float64
+	// Message is the error when a check fails, instead of one that says which check failed.
+	Message string
+
+	path  *jsonpath.Path
+	regex *regexp.Regexp
+}
+
+func (x *Expect) validate() error {
+	if x.Contains == "" && x.Regex == "" && x.Equals == "" && x.In == nil && x.GreaterThan == nil && x.AtLeast == nil &&
+		x.LessThan == nil && x.AtMost == nil {
+		return fmt.Errorf("Expect must have at least one check")
+	}
+
+	x.JSONPath = strings.TrimSpace(x.JSONPath)
+	if x.JSONPath != "" {
+		p, err := jsonpath.Parse(x.JSONPath)
+		if err != nil {
+			return fmt.Errorf("Expect had an invalid JSONPath: %s", err)
+		}
+		x.path = &p
+	}
+	if x.Regex != "" {
+		re, err := regexp.Compile(x.Regex)
+		if err != nil {
+			return fmt.Errorf("Expect had an invalid Regex(%s): %s", x.Regex, err)
+		}
+		x.regex = re
+	}
+	return nil
+}
+
+// ExpectError is returned by Expect.Check when a check fails.
+type ExpectError struct {
+	// Value is the value that was checked.
+	Value string
+	// Msg says which check failed, or is the Expect's Message.
+	Msg string
+}
+
+func (e *ExpectError) Error() string {
+	return fmt.Sprintf("%s, got value: %q", e.Msg, e.Value)
+}
+
+// Check checks "stdout" against the Expect. "render" executes the templates in the Expect's string values.
+// A failed check returns an *ExpectError.
+func (x *Expect) Check(stdout []byte, render func(string) (string, error)) error {
+	value := strings.TrimSpace(string(stdout))
+	if x.path != nil {
+		v, err := x.path.GetString(stdout)
+		if err != nil {
+			return x.fail(value, fmt.Sprintf("JSONPath(%s): %s", x.JSONPath, err))
+		}
+		value = v
+	}
+
+	if x.Contains != "" {
+		want, err := render(x.Contains)
+		if err != nil {
+			return fmt.Errorf("Expect Contains: %w", err)
+		}
+		if !strings.Contains(value, want) {
+			return x.fail(value, fmt.Sprintf("expected value to contain %q", want))
+		}
+	}
+	if x.regex != nil && !x.regex.MatchString(value) {
+		return x.fail(value, fmt.Sprintf("expected value to match Regex(%s)", x.Regex))
+	}
+	if x.Equals != "" {
+		want, err := render(x.Equals)
+		if err != nil {
+			return fmt.Errorf("Expect Equals: %w", err)
+		}
+		if value != want {
+			return x.fail(value, fmt.Sprintf("expected value to equal %q", want))
+		}
+	}
+	if x.In != nil {
+		found := false
+		in := make([]string, 0, len(x.In))
+		for _, s := range x.In {
+			want, err := render(s)
+			if err != nil {
+				return fmt.Errorf("Expect In: %w", err)
+			}
+			in = append(in, want)
+			if value == want {
+				found = true
+			}
+		}
+		if !found {
+			return x.fail(value, fmt.Sprintf("expected value to be one of %q", in))
+		}
+	}
+
+	nums := []struct {
+		name  string
+		limit *float64
+		ok    func(n, limit float64) bool
+	}{
+		{"GreaterThan", x.GreaterThan, func(n, limit float64) bool { return n > limit }},
+		{"AtLeast", x.AtLeast, func(n, limit float64) bool { return n >= limit }},
+		{"LessThan", x.LessThan, func(n, limit float64) bool { return n < limit }},
+		{"AtMost", x.AtMost, func(n, limit float64) bool { return n <= limit }},
+	}
+	for _, c := range nums {
+		if c.limit == nil {
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return x.fail(value, fmt.Sprintf("expected value to be a number for %s", c.name))
+		}
+		if !c.ok(n, *c.limit) {
+			return x.fail(value, fmt.Sprintf("expected value to be %s %v", c.name, *c.limit))
+		}
+	}
+	return nil
+}
+
+// fail returns an *ExpectError for "value", using the Expect's Message if it has one instead of "msg".
+func (x *Expect) fail(value, msg string) error {
+	if x.Message != "" {
+		msg = x.Message
+	}
+	return &ExpectError{Value: value, Msg: msg}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExpectCheck(t *testing.T) {
+	f := func(n float64) *float64 { return &n }
+	render := func(s string) (string, error) {
+		return strings.ReplaceAll(s, "{{ .State }}", "Succeeded"), nil
+	}
+	doc := `{"properties": {"provisioningState": "Succeeded", "count": 3}}`
+
+	tests := []struct {
+		desc    string
+		expect  *Expect
+		stdout  string
+		wantMsg string
+	}{
+		{desc: "Contains", expect: &Expect{Contains: "ok"}, stdout: "all ok\n"},
+		{desc: "Contains fails", expect: &Expect{Contains: "ok"}, stdout: "bad", wantMsg: `expected value to contain "ok"`},
+		{desc: "Regex", expect: &Expect{Regex: "^v[0-9]+$"}, stdout: "v12"},
+		{desc: "JSONPath Equals", expect: &Expect{JSONPath: "$.properties.provisioningState", Equals: "{{ .State }}"}, stdout: doc},
+		{
+			desc:    "JSONPath Equals fails with Message",
+			expect:  &Expect{JSONPath: "$.properties.provisioningState", Equals: "Failed", Message: "cluster did not fail"},
+			stdout:  doc,
+			wantMsg: "cluster did not fail",
+		},
+		{desc: "JSONPath In", expect: &Expect{JSONPath: "$.properties.provisioningState", In: []string{"Creating", "Succeeded"}}, stdout: doc},
+		{
+			desc:    "JSONPath In fails",
+			expect:  &Expect{JSONPath: "$.properties.provisioningState", In: []string{"Creating", "Updating"}},
+			stdout:  doc,
+			wantMsg: `expected value to be one of ["Creating" "Updating"]`,
+		},
+		{desc: "Numeric", expect: &Expect{JSONPath: "$.properties.count", GreaterThan: f(2), AtMost: f(3)}, stdout: doc},
+		{desc: "Numeric fails", expect: &Expect{JSONPath: "$.properties.count", LessThan: f(3)}, stdout: doc, wantMsg: "expected value to be LessThan 3"},
+		{desc: "Not a number", expect: &Expect{AtLeast: f(0)}, stdout: "many", wantMsg: "expected value to be a number for AtLeast"},
+		{desc: "Missing JSONPath", expect: &Expect{JSONPath: "$.missing", Equals: "x"}, stdout: doc, wantMsg: `JSONPath($.missing): $ has no field "missing"`},
+	}
+
+	for _, test := range tests {
+		if err := test.expect.validate(); err != nil {
+			t.Errorf("TestExpectCheck(%s): got validate err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		err := test.expect.Check([]byte(test.stdout), render)
+		switch {
+		case err == nil && test.wantMsg != "":
+			t.Errorf("TestExpectCheck(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && test.wantMsg == "":
+			t.Errorf("TestExpectCheck(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err == nil:
+			continue
+		}
+		expectErr := &ExpectError{}
+		if !errors.As(err, &expectErr) {
+			t.Errorf("TestExpectCheck(%s): got err of type %T, want *ExpectError", test.desc, err)
+			continue
+		}
+		if expectErr.Msg != test.wantMsg {
+			t.Errorf("TestExpectCheck(%s): got Msg %q, want %q", test.desc, expectErr.Msg, test.wantMsg)
+		}
+	}
+}
+
+func TestExpectValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		expect  *Expect
+		wantErr bool
+	}{
+		{desc: "No checks", expect: &Expect{JSONPath: "$.a"}, wantErr: true},
+		{desc: "Bad Regex", expect: &Expect{Regex: "("}, wantErr: true},
+		{desc: "Bad JSONPath", expect: &Expect{JSONPath: "$..a", Equals: "x"}, wantErr: true},
+		{desc: "Valid", expect: &Expect{JSONPath: "$.a", Equals: "x"}},
+	}
+
+	for _, test := range tests {
+		err := test.expect.validate()
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestExpectValidate(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestExpectValidate(%s): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
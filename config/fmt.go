@@ -0,0 +1,388 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/element-of-surprise/runme/internal/lexer"
+)
+
+// maxCmdLine is the longest line a Cmd can be on before FormatTOML splits it into one argument per line.
+const maxCmdLine = 100
+
+// tableTypes are the types of the tables in a config, keyed by the table name. Tables that hold Sequences
+// are not listed here, see seqTables.
+var tableTypes = map[string]reflect.Type{
+	"":           reflect.TypeOf(Config{}),
+	"Required":   reflect.TypeOf(Required{}),
+	"CreateVars": reflect.TypeOf(CreateVar{}),
+	"Macros":     reflect.TypeOf(Macro{}),
+}
+
+// seqTables are the names of tables that hold Sequences.
+var seqTables = map[string]bool{
+	"Seqs":                  true,
+	"Seqs.OnFailure":        true,
+	"Finally":               true,
+	"Finally.OnFailure":     true,
+	"Macros.Seqs":           true,
+	"Macros.Seqs.OnFailure": true,
+}
+
+// FormatTOML returns the TOML config "b" in canonical form. Keys are indented by a tab for each level of
+// table they are in and ordered the way they are declared in the type they are decoded into. A Cmd that is too
+// long is written with one argument per line. Comments are kept with the key or table that follows them.
+// Values are not changed, other than the layout of Cmd.
+func FormatTOML(b []byte) ([]byte, error) {
+	m := map[string]interface{}{}
+	if _, err := toml.Decode(string(b), &m); err != nil {
+		return nil, err
+	}
+
+	doc, err := parseTOML(string(b))
+	if err != nil {
+		return nil, err
+	}
+	return doc.render()
+}
+
+// tomlEntry is a key = value line in a TOML file.
+type tomlEntry struct {
+	// comments are the comment lines that come before the entry.
+	comments []string
+	key      string
+	// value is the raw value, which may span multiple lines.
+	value string
+	// comment is a comment on the same line as the value.
+	comment string
+}
+
+// tomlTable is a table in a TOML file and its entries.
+type tomlTable struct {
+	comments []string
+	// name is the name of the table, which is "" for the keys before any table.
+	name    string
+	array   bool
+	comment string
+	entries []*tomlEntry
+}
+
+type tomlDoc struct {
+	tables []*tomlTable
+	// trailing are comments at the end of the file.
+	trailing []string
+}
+
+// parseTOML splits a TOML file into tables and entries. The file must already be known to be valid TOML.
+func parseTOML(s string) (*tomlDoc, error) {
+	doc := &tomlDoc{}
+	table := &tomlTable{}
+	doc.tables = append(doc.tables, table)
+
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	comments := []string{}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			comments = append(comments, line)
+			continue
+		case strings.HasPrefix(line, "["):
+			t, err := parseHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", i+1, err)
+			}
+			t.comments = comments
+			comments = []string{}
+			table = t
+			doc.tables = append(doc.tables, t)
+			continue
+		}
+
+		eq := indexOutside(line, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		e := &tomlEntry{comments: comments, key: strings.TrimSpace(line[:eq])}
+		comments = []string{}
+
+		value := strings.TrimSpace(line[eq+1:])
+		for !valueComplete(value) {
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("key(%s) has a value that never ends", e.key)
+			}
+			value += "\n" + lines[i]
+		}
+		if !strings.Contains(value, "\n") {
+			if c := indexOutside(value, '#'); c != -1 {
+				e.comment = strings.TrimSpace(value[c:])
+				value = strings.TrimSpace(value[:c])
+			}
+		}
+		e.value = value
+		table.entries = append(table.entries, e)
+	}
+	doc.trailing = comments
+	return doc, nil
+}
+
+// parseHeader parses a table header such as [[Seqs]] or [Seqs.Params].
+func parseHeader(line string) (*tomlTable, error) {
+	t := &tomlTable{}
+	if c := indexOutside(line, '#'); c != -1 {
+		t.comment = strings.TrimSpace(line[c:])
+		line = strings.TrimSpace(line[:c])
+	}
+	switch {
+	case strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "]]"):
+		t.array = true
+		line = line[2 : len(line)-2]
+	case strings.HasSuffix(line, "]"):
+		line = line[1 : len(line)-1]
+	default:
+		return nil, fmt.Errorf("bad table header(%s)", line)
+	}
+	parts := strings.Split(line, ".")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	t.name = strings.Join(parts, ".")
+	return t, nil
+}
+
+// indexOutside returns the index of the first "r" in "s" that is not inside a string, or -1.
+func indexOutside(s string, r byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote == 0 && s[i] == r:
+			return i
+		case quote == 0 && (s[i] == '"' || s[i] == '\''):
+			quote = s[i]
+		case quote == '"' && s[i] == '\\':
+			i++
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		}
+	}
+	return -1
+}
+
+// valueComplete returns true if "v" holds an entire TOML value. A value is incomplete if it has an
+// unclosed multi-line string or an unclosed array or inline table.
+func valueComplete(v string) bool {
+	for _, delim := range []string{`"""`, `'''`} {
+		if strings.HasPrefix(v, delim) {
+			return strings.Count(v, delim) >= 2
+		}
+	}
+
+	depth := 0
+	var quote byte
+	for i := 0; i < len(v); i++ {
+		switch {
+		case quote == '"' && v[i] == '\\':
+			i++
+		case quote != 0:
+			if v[i] == quote {
+				quote = 0
+			}
+		case v[i] == '"' || v[i] == '\'':
+			quote = v[i]
+		case v[i] == '#':
+			// The rest of the line is a comment.
+			for i < len(v) && v[i] != '\n' {
+				i++
+			}
+		case v[i] == '[' || v[i] == '{':
+			depth++
+		case v[i] == ']' || v[i] == '}':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// render returns the canonical form of the document.
+func (d *tomlDoc) render() ([]byte, error) {
+	b := &bytes.Buffer{}
+	for i, t := range d.tables {
+		if t.name == "" && len(t.entries) == 0 && len(t.comments) == 0 {
+			continue
+		}
+		depth := 0
+		if t.name != "" {
+			depth = strings.Count(t.name, ".") + 1
+		}
+		if b.Len() > 0 && (depth <= 1 || len(t.comments) > 0) {
+			b.WriteString("\n")
+		}
+
+		indent := strings.Repeat("\t", depth)
+		if t.name != "" {
+			hindent := strings.Repeat("\t", depth-1)
+			for _, c := range t.comments {
+				b.WriteString(hindent + c + "\n")
+			}
+			header := "[" + t.name + "]"
+			if t.array {
+				header = "[[" + t.name + "]]"
+			}
+			if t.comment != "" {
+				header += " " + t.comment
+			}
+			b.WriteString(hindent + header + "\n")
+		}
+
+		// A Cmd run by a Shell is a script, where lines matter.
+		shell := false
+		for _, e := range t.entries {
+			if e.key == "Shell" {
+				shell = true
+			}
+		}
+
+		for _, e := range sortEntries(t) {
+			for _, c := range e.comments {
+				b.WriteString(indent + c + "\n")
+			}
+			value := e.value
+			if e.key == "Cmd" && seqTables[t.name] && !shell {
+				value = formatCmd(indent, value)
+			}
+			line := indent + e.key + " = " + value
+			if e.comment != "" {
+				line += " " + e.comment
+			}
+			b.WriteString(line + "\n")
+		}
+
+		if i == len(d.tables)-1 && len(d.trailing) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	for _, c := range d.trailing {
+		b.WriteString(c + "\n")
+	}
+	return b.Bytes(), nil
+}
+
+// sortEntries returns the entries of "t" in the order of the fields in the type the table decodes into.
+// Keys that are not fields are put at the end in their original order.
+func sortEntries(t *tomlTable) []*tomlEntry {
+	var typ reflect.Type
+	if seqTables[t.name] {
+		m := map[string]interface{}{}
+		for _, e := range t.entries {
+			m[e.key] = nil
+		}
+		for _, k := range seqKinds {
+			if _, ok := m[k.key]; ok {
+				typ = k.typ
+				break
+			}
+		}
+	} else {
+		typ = tableTypes[t.name]
+	}
+	if typ == nil {
+		return t.entries
+	}
+
+	order := fieldOrder(typ)
+	sorted := make([]*tomlEntry, 0, len(t.entries))
+	for _, name := range order {
+		for _, e := range t.entries {
+			if e.key == name {
+				sorted = append(sorted, e)
+			}
+		}
+	}
+	known := map[string]bool{}
+	for _, name := range order {
+		known[name] = true
+	}
+	for _, e := range t.entries {
+		if !known[e.key] {
+			sorted = append(sorted, e)
+		}
+	}
+	return sorted
+}
+
+// fieldOrder returns the names of the exported fields of "t" in the order they are declared. The fields
+// of embedded structs are included where the struct is embedded.
+func fieldOrder(t reflect.Type) []string {
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			names = append(names, fieldOrder(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// formatCmd formats the raw TOML value of a Cmd. Short commands are written on a single line. Long
+// commands are written in a multi-line string with the program and any sub-commands on the first
+// line and each flag with its values on its own line. If the value can't be understood, it is returned as is.
+func formatCmd(indent, raw string) string {
+	v := struct{ Cmd string }{}
+	if _, err := toml.Decode("Cmd = "+raw, &v); err != nil {
+		return raw
+	}
+	cmd := joinLines(v.Cmd)
+
+	single := quoteBasic(cmd)
+	if len(indent)+len("Cmd = ")+len(single) <= maxCmdLine && !strings.Contains(cmd, "\n") {
+		return single
+	}
+
+	words := []string{}
+	for item := range lexer.New().Parse(cmd) {
+		if item.Type == lexer.ItemErr {
+			return raw
+		}
+		words = append(words, item.Raw)
+	}
+
+	lines := []string{}
+	line := []string{}
+	for _, w := range words {
+		if strings.HasPrefix(w, "-") && len(line) > 0 {
+			lines = append(lines, strings.Join(line, " "))
+			line = nil
+		}
+		line = append(line, w)
+	}
+	if len(line) > 0 {
+		lines = append(lines, strings.Join(line, " "))
+	}
+
+	b := strings.Builder{}
+	b.WriteString(`"""` + "\n")
+	for _, l := range lines {
+		l = strings.ReplaceAll(l, `\`, `\\`)
+		l = strings.ReplaceAll(l, `"""`, `""\"`)
+		b.WriteString(indent + l + "\n")
+	}
+	b.WriteString(indent + `"""`)
+	return b.String()
+}
+
+// quoteBasic returns "s" as a TOML basic string.
+func quoteBasic(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\t", `\t`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestFormatTOML(t *testing.T) {
+	tests := []struct {
+		desc string
+		in   string
+		want string
+	}{
+		{
+			desc: "Indentation, key order and comments",
+			in: `Include = ["common.toml"]
+[[Required]]
+Regex = "^[a-z]+$"
+  Name = "Region" # the region
+[[Seqs]]
+    # Stores the group.
+    ValueKey = "Group"
+	Cmd = "az group show --name {{ .Region }}"
+  Name = "ShowGroup"
+
+
+[[Seqs]]
+	Name = "Write"
+	Value = """
+line one
+  line two
+"""
+	Path = "./out.txt"
+# The end.
+`,
+			want: `Include = ["common.toml"]
+
+[[Required]]
+	Name = "Region" # the region
+	Regex = "^[a-z]+$"
+
+[[Seqs]]
+	Name = "ShowGroup"
+	Cmd = "az group show --name {{ .Region }}"
+	# Stores the group.
+	ValueKey = "Group"
+
+[[Seqs]]
+	Name = "Write"
+	Path = "./out.txt"
+	Value = """
+line one
+  line two
+"""
+
+# The end.
+`,
+		},
+		{
+			desc: "Long Cmd is split and short Cmd is joined",
+			in: `[[Seqs]]
+	Name = "Create"
+	Cmd = "az role assignment create --role \"Managed Identity Operator\" --assignee {{ .MSIID }} --scope /subscriptions/{{ .Subscription }}"
+[[Seqs]]
+	Name = "Show"
+	Cmd = """
+	az group show
+	--name {{ .Region }}
+	"""
+`,
+			want: `[[Seqs]]
+	Name = "Create"
+	Cmd = """
+	az role assignment create
+	--role "Managed Identity Operator"
+	--assignee {{ .MSIID }}
+	--scope /subscriptions/{{ .Subscription }}
+	"""
+
+[[Seqs]]
+	Name = "Show"
+	Cmd = "az group show --name {{ .Region }}"
+`,
+		},
+		{
+			desc: "Cmd with tabs is joined as the Runner joins it",
+			in: `[[Seqs]]
+	Name = "Show"
+	Cmd = '''
+\taz group show \
+\t--name {{ .Region }}
+'''
+`,
+			want: `[[Seqs]]
+	Name = "Show"
+	Cmd = "az group show --name {{ .Region }}"
+`,
+		},
+		{
+			desc: "Nested tables",
+			in: `[[Macros]]
+Params = ["Sub"]
+Name = "Login"
+[[Macros.Seqs]]
+Cmd = "az account set -s {% .Sub %}"
+Name = "SetAccount"
+[[Seqs]]
+Macro = "Login"
+Name = "Prod"
+[Seqs.Params]
+Sub = "prod"
+`,
+			want: `[[Macros]]
+	Name = "Login"
+	Params = ["Sub"]
+	[[Macros.Seqs]]
+		Name = "SetAccount"
+		Cmd = "az account set -s {% .Sub %}"
+
+[[Seqs]]
+	Name = "Prod"
+	Macro = "Login"
+	[Seqs.Params]
+		Sub = "prod"
+`,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := FormatTOML([]byte(test.in))
+		if err != nil {
+			t.Errorf("TestFormatTOML(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(test.want, string(got)); diff != "" {
+			t.Errorf("TestFormatTOML(%s): -want/+got:\n%s", test.desc, diff)
+			continue
+		}
+		again, err := FormatTOML(got)
+		if err != nil {
+			t.Errorf("TestFormatTOML(%s): formatting a second time got err == %s", test.desc, err)
+			continue
+		}
+		if diff := pretty.Compare(string(got), string(again)); diff != "" {
+			t.Errorf("TestFormatTOML(%s): formatting is not stable: -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+// TestFormatTOMLSameConfig tests that formatting our example config does not change what it decodes to.
+func TestFormatTOMLSameConfig(t *testing.T) {
+	orig, err := f.ReadFile("config.toml")
+	if err != nil {
+		panic(err)
+	}
+	formatted, err := FormatTOML(orig)
+	if err != nil {
+		t.Fatalf("TestFormatTOMLSameConfig: got err == %s", err)
+	}
+
+	vals := func() map[string]string {
+		return map[string]string{"Subscription": "Subscription", "Tenant": "tenant", "Region": "region"}
+	}
+
+	wfs := simple.New()
+	if err := wfs.WriteFile("orig.toml", orig, 0600); err != nil {
+		panic(err)
+	}
+	if err := wfs.WriteFile("formatted.toml", formatted, 0600); err != nil {
+		panic(err)
+	}
+	want, err := FromFile(wfs, "orig.toml", vals())
+	if err != nil {
+		panic(err)
+	}
+	got, err := FromFile(wfs, "formatted.toml", vals())
+	if err != nil {
+		t.Fatalf("TestFormatTOMLSameConfig: formatted config got err == %s", err)
+	}
+
+	pconf := pretty.Config{Diffable: true, IncludeUnexported: true, SkipZeroFields: true}
+	if diff := pconf.Compare(want.Sequences(), got.Sequences()); diff != "" {
+		t.Errorf("TestFormatTOMLSameConfig: -want/+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateFunc validates a Runner that runs a Func instead of a command.
+func (r *Runner) validateFunc() error {
+	r.Func = strings.TrimSpace(r.Func)
+	switch {
+	case r.Cmd != "" || r.Shell != "" || r.Pipeline != nil:
+		return fmt.Errorf("Runner(%s) cannot have Func with Cmd, Shell or Pipeline", r.Name)
+	case r.Stdin != "" || r.StdinFrom != "":
+		return fmt.Errorf("Runner(%s) cannot have Func with Stdin or StdinFrom, a Func is given the vals", r.Name)
+	case r.Env != nil || r.InheritEnv != nil || r.WorkDir != "":
+		return fmt.Errorf("Runner(%s) cannot have Func with Env, InheritEnv or WorkDir", r.Name)
+	case r.Interactive:
+		return fmt.Errorf("Runner(%s) cannot have both Func and Interactive", r.Name)
+	case r.Undo != "":
+		return fmt.Errorf("Runner(%s) cannot have Func with Undo, a Func has no command to undo it with", r.Name)
+	case r.MaxOutput.Bytes > 0 || r.AllowedExitCodes != nil:
+		return fmt.Errorf("Runner(%s) cannot have Func with MaxOutput or AllowedExitCodes", r.Name)
+	}
+
+	for k, v := range r.Outputs {
+		if strings.TrimSpace(k) == "" || strings.TrimSpace(v) == "" {
+			return fmt.Errorf("Runner(%s) cannot have an Output with an empty key or value", r.Name)
+		}
+		if reserved(k) {
+			return fmt.Errorf("Runner(%s) cannot have Output(%s), which is reserved", r.Name, k)
+		}
+	}
+	return nil
+}
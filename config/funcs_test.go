@@ -0,0 +1,96 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestFuncValidate(t *testing.T) {
+	tests := []struct {
+		desc        string
+		content     string
+		wantErr     bool
+		wantDefines []string
+	}{
+		{
+			desc: "Func",
+			content: `
+[[Seqs]]
+	Name = "Validate"
+	Func = "validateCluster"
+	Retries = 2
+	RetrySleep = "1s"
+	ValueKey = "Result"
+	[Seqs.Outputs]
+		State = "state"
+	[[Seqs.Expect]]
+		JSONPath = "$.state"
+		Equals = "ok"
+`,
+			wantDefines: []string{"Result", "State"},
+		},
+		{
+			desc: "Func with Cmd",
+			content: `
+[[Seqs]]
+	Name = "Validate"
+	Func = "validateCluster"
+	Cmd = "ls"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Func with Stdin",
+			content: `
+[[Seqs]]
+	Name = "Validate"
+	Func = "validateCluster"
+	Stdin = "hello"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Func with Undo",
+			content: `
+[[Seqs]]
+	Name = "Validate"
+	Func = "validateCluster"
+	Undo = "az group delete"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Outputs without Func",
+			content: `
+[[Seqs]]
+	Name = "Validate"
+	Cmd = "ls"
+	[Seqs.Outputs]
+		State = "state"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Reserved Output",
+			content: `
+[[Seqs]]
+	Name = "Validate"
+	Func = "validateCluster"
+	[Seqs.Outputs]
+		Workspace = "state"
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		c, ok := readContent(t, test.desc, test.content, test.wantErr)
+		if !ok {
+			continue
+		}
+		if diff := pretty.Compare(test.wantDefines, c.Sequences()[0].Defines()); diff != "" {
+			t.Errorf("TestFuncValidate(%s): Defines(): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"strings"
+	"text/template"
+
+	gfs "github.com/gopherfs/fs"
+)
+
+// Macro is a named set of Seqs that can be used multiple times with different parameters.
+// Parameters are substituted when the config is loaded using text/template with the delimiters
+// {% and %}, such as {% .Subscription %}. Normal {{ }} templates are left alone and are
+// executed when the Sequence runs.
+type Macro struct {
+	// Name is the unique name of the Macro. This must be unique across all included files.
+	Name string
+	// Params are the names of the parameters that must be passed when using the Macro.
+	Params []string
+	// Seqs are the Sequences that make up the Macro. A Macro cannot use another Macro.
+	Seqs []map[string]interface{}
+
+	file string
+}
+
+// UseMacro is an entry in Seqs that is replaced by the Sequences in a Macro. Each Sequence
+// is renamed to "[UseMacro.Name]/[Sequence name]".
+type UseMacro struct {
+	// Name is the unique name of this use of the Macro.
+	Name string
+	// Macro is the name of the Macro to use.
+	Macro string
+	// Params are the values for the Macro's Params. These may contain {{ }} templates that
+	// will be executed when the Sequence runs.
+	Params map[string]string
+}
+
+func (u *UseMacro) Sequence() string {
+	return u.Name
+}
+
+// loader loads config files and the files they include.
+type loader struct {
+	fsys gfs.Writer
+
+	// loading are the files currently being loaded, used to detect Include cycles.
+	loading map[string]bool
+	// loaded are files that have already been loaded. A file is only included once.
+	loaded map[string]bool
+	macros map[string]*Macro
+	// calling are the configs that are being loaded because of a Call, used to detect Call cycles.
+	// This is shared with the loaders of any configs we Call.
+	calling map[string]bool
+}
+
+func newLoader(fsys gfs.Writer, calling map[string]bool) *loader {
+	return &loader{
+		fsys:    fsys,
+		loading: map[string]bool{},
+		loaded:  map[string]bool{},
+		macros:  map[string]*Macro{},
+		calling: calling,
+	}
+}
+
+// config loads the config at "p" along with its included files, expands Macros, loads the
+// configs referenced by any Call and validates the result.
+func (l *loader) config(p string) (*Config, error) {
+	p = path.Clean(p)
+	if l.calling[p] {
+		return nil, fmt.Errorf("config(%s) is called in a cycle", p)
+	}
+	l.calling[p] = true
+	defer delete(l.calling, p)
+
+	c, err := l.load(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.expand(c); err != nil {
+		return nil, err
+	}
+
+	for _, s := range c.allSequences() {
+		if s.call == nil {
+			continue
+		}
+		child, err := newLoader(l.fsys, l.calling).config(s.call.Config)
+		if err != nil {
+			return nil, fmt.Errorf("Call(%s): %w", s.call.Name, err)
+		}
+		s.call.config = child
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("config(%s): %w", p, err)
+	}
+	return c, nil
+}
+
+// load reads the config at "p" and merges all of its included files into it.
+func (l *loader) load(p string) (*Config, error) {
+	p = path.Clean(p)
+	if l.loading[p] {
+		return nil, fmt.Errorf("config(%s) is included in a cycle", p)
+	}
+	l.loading[p] = true
+	defer delete(l.loading, p)
+	l.loaded[p] = true
+
+	b, err := fs.ReadFile(l.fsys, p)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeConfig(FormatOf(p), b)
+	if err != nil {
+		return nil, fmt.Errorf("config(%s): %w", p, err)
+	}
+
+	for _, m := range c.Macros {
+		m.Name = strings.TrimSpace(m.Name)
+		if m.Name == "" {
+			return nil, fmt.Errorf("config(%s): a Macro cannot have an empty name field", p)
+		}
+		if prev, ok := l.macros[m.Name]; ok {
+			return nil, fmt.Errorf("Macro(%s) is defined in both config(%s) and config(%s)", m.Name, prev.file, p)
+		}
+		m.file = p
+		l.macros[m.Name] = m
+
+		// Decode the Sequences so that errors and unknown keys are found when loading,
+		// not when the Macro is used.
+		for i, prim := range m.Seqs {
+			s, err := decodeSeq(prim)
+			if err != nil {
+				return nil, fmt.Errorf("config(%s): Macro(%s): Sequence(%d) %s", p, m.Name, i, err)
+			}
+			if s.useMacro != nil {
+				return nil, fmt.Errorf("config(%s): Macro(%s): Sequence(%d) cannot use another Macro", p, m.Name, i)
+			}
+		}
+	}
+
+	for i, seq := range c.Seqs {
+		s, err := decodeSeq(seq)
+		if err != nil {
+			return nil, fmt.Errorf("config(%s): Sequence(%d) %s", p, i, err)
+		}
+		s.resolve(p)
+		c.sequences = append(c.sequences, s)
+	}
+	for i, seq := range c.Finally {
+		s, err := decodeSeq(seq)
+		if err != nil {
+			return nil, fmt.Errorf("config(%s): Finally(%d) %s", p, i, err)
+		}
+		s.resolve(p)
+		c.finally = append(c.finally, s)
+	}
+
+	inc := &Config{}
+	for _, name := range c.Include {
+		ip := resolvePath(p, name)
+		if l.loaded[path.Clean(ip)] && !l.loading[path.Clean(ip)] {
+			continue
+		}
+		ic, err := l.load(ip)
+		if err != nil {
+			return nil, fmt.Errorf("config(%s): %w", p, err)
+		}
+		inc.Required = append(inc.Required, ic.Required...)
+		inc.CreateVars = append(inc.CreateVars, ic.CreateVars...)
+		inc.sequences = append(inc.sequences, ic.sequences...)
+		inc.finally = append(inc.finally, ic.finally...)
+		for k, v := range ic.Env {
+			if inc.Env == nil {
+				inc.Env = map[string]string{}
+			}
+			inc.Env[k] = v
+		}
+		if ic.InheritEnv != nil {
+			inc.InheritEnv = ic.InheritEnv
+		}
+	}
+	// Our Env and InheritEnv win over those of the files we include.
+	for k, v := range c.Env {
+		if inc.Env == nil {
+			inc.Env = map[string]string{}
+		}
+		inc.Env[k] = v
+	}
+	c.Env = inc.Env
+	if c.InheritEnv == nil {
+		c.InheritEnv = inc.InheritEnv
+	}
+	c.Required = append(inc.Required, c.Required...)
+	c.CreateVars = append(inc.CreateVars, c.CreateVars...)
+	c.sequences = append(inc.sequences, c.sequences...)
+	c.finally = append(inc.finally, c.finally...)
+
+	return c, nil
+}
+
+// resolvePath returns "name" relative to the directory of the config file at "p", unless "name" is absolute.
+func resolvePath(p, name string) string {
+	if path.IsAbs(name) {
+		return name
+	}
+	return path.Join(path.Dir(p), name)
+}
+
+// expand replaces all UseMacro entries in the Seqs and Finally of "c" with the Sequences of the Macro.
+func (l *loader) expand(c *Config) error {
+	for _, list := range []*[]*Sequence{&c.sequences, &c.finally} {
+		seqs := make([]*Sequence, 0, len(*list))
+		for _, s := range *list {
+			if s.useMacro == nil {
+				seqs = append(seqs, s)
+				continue
+			}
+			expanded, err := l.instantiate(s.useMacro)
+			if err != nil {
+				return err
+			}
+			seqs = append(seqs, expanded...)
+		}
+		*list = seqs
+	}
+	return nil
+}
+
+// instantiate returns the Sequences for a single use of a Macro.
+func (l *loader) instantiate(u *UseMacro) ([]*Sequence, error) {
+	u.Name = strings.TrimSpace(u.Name)
+	if u.Name == "" {
+		return nil, fmt.Errorf("a use of Macro(%s) cannot have an empty name field", u.Macro)
+	}
+	m, ok := l.macros[u.Macro]
+	if !ok {
+		return nil, fmt.Errorf("UseMacro(%s): Macro(%s) is not defined", u.Name, u.Macro)
+	}
+
+	params := map[string]bool{}
+	for _, p := range m.Params {
+		params[p] = true
+		if _, ok := u.Params[p]; !ok {
+			return nil, fmt.Errorf("UseMacro(%s): Macro(%s) requires parameter(%s)", u.Name, u.Macro, p)
+		}
+	}
+	for p := range u.Params {
+		if !params[p] {
+			return nil, fmt.Errorf("UseMacro(%s): Macro(%s) does not have parameter(%s)", u.Name, u.Macro, p)
+		}
+	}
+
+	seqs := make([]*Sequence, 0, len(m.Seqs))
+	for i, prim := range m.Seqs {
+		// We decode again so that every use of the Macro gets its own copy.
+		s, err := decodeSeq(prim)
+		if err != nil {
+			return nil, fmt.Errorf("UseMacro(%s): Sequence(%d) %s", u.Name, i, err)
+		}
+
+		err = s.each(func(s *Sequence) error {
+			err := walkStrings(
+				reflect.ValueOf(s.Item()),
+				func(s string) (string, error) {
+					return expandParams(s, u.Params)
+				},
+			)
+			if err != nil {
+				return err
+			}
+			name := reflect.ValueOf(s.Item()).Elem().FieldByName("Name")
+			name.SetString(u.Name + "/" + strings.TrimSpace(name.String()))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("UseMacro(%s): Sequence(%d) %s", u.Name, i, err)
+		}
+
+		s.resolve(m.file)
+		seqs = append(seqs, s)
+	}
+	return seqs, nil
+}
+
+// expandParams substitutes Macro parameters into "s".
+func expandParams(s string, params map[string]string) (string, error) {
+	if !strings.Contains(s, "{%") {
+		return s, nil
+	}
+	tmpl, err := template.New("").Delims("{%", "%}").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("violated a text/template rule: %s", err)
+	}
+	b := strings.Builder{}
+	if err := tmpl.Execute(&b, params); err != nil {
+		return "", fmt.Errorf("problem with Macro parameter substitution: %s", err)
+	}
+	return b.String(), nil
+}
+
+// walkStrings calls "fn" on every exported string found in "v", which must be a pointer, and replaces the
+// string with the returned value. It descends into structs, pointers, slices and maps.
+func walkStrings(v reflect.Value, fn func(string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return walkStrings(v.Elem(), fn)
+	case reflect.String:
+		if !v.CanSet() {
+			return errors.New("bug: walkStrings found a string that cannot be set")
+		}
+		s, err := fn(v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			if err := walkStrings(v.Field(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkStrings(v.Index(i), fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, k := range v.MapKeys() {
+			s, err := fn(v.MapIndex(k).String())
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(k, reflect.ValueOf(s).Convert(v.Type().Elem()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxRetrySleep is the most time a Runner can spend sleeping between its retries.
+const maxRetrySleep = 30 * time.Minute
+
+// RetryCond is a condition on the result of a failed command, used by RetryOn and NoRetryOn. It matches if any of
+// its fields match.
+type RetryCond struct {
+	// ExitCodes matches if the command exited with one of these codes.
+	ExitCodes []int
+	// Stdout is a regex that matches if it matches the stdout of the command.
+	Stdout string
+	// Stderr is a regex that matches if it matches the stderr of the command, such as "throttled|429".
+	Stderr string
+	// Expect matches if the command succeeded but one of the Runner's Expect checks failed.
+	Expect bool
+
+	stdout, stderr *regexp.Regexp
+}
+
+func (r *RetryCond) validate() error {
+	if len(r.ExitCodes) == 0 && r.Stdout == "" && r.Stderr == "" && !r.Expect {
+		return fmt.Errorf("must have at least one of ExitCodes, Stdout, Stderr or Expect")
+	}
+	var err error
+	if r.Stdout != "" {
+		if r.stdout, err = regexp.Compile(r.Stdout); err != nil {
+			return fmt.Errorf("had an invalid Stdout regex(%s): %s", r.Stdout, err)
+		}
+	}
+	if r.Stderr != "" {
+		if r.stderr, err = regexp.Compile(r.Stderr); err != nil {
+			return fmt.Errorf("had an invalid Stderr regex(%s): %s", r.Stderr, err)
+		}
+	}
+	return nil
+}
+
+// Match returns a description of what matched the result of a command that exited with "code" and output
+// "stdout" and "stderr". "expectErr" is set if an Expect check failed. If nothing matched, this returns "".
+func (r *RetryCond) Match(code int, stdout, stderr []byte, expectErr *ExpectError) string {
+	if r.Expect && expectErr != nil {
+		return fmt.Sprintf("Expect(%s)", expectErr.Msg)
+	}
+	for _, c := range r.ExitCodes {
+		if c == code {
+			return fmt.Sprintf("exit code(%d)", code)
+		}
+	}
+	if r.stdout != nil && r.stdout.Match(stdout) {
+		return fmt.Sprintf("stdout matched(%s)", r.Stdout)
+	}
+	if r.stderr != nil && r.stderr.Match(stderr) {
+		return fmt.Sprintf("stderr matched(%s)", r.Stderr)
+	}
+	return ""
+}
+
+// RetrySleepFor returns how long to sleep before retry number "retry", which starts at 1, without Jitter.
+func (r *Runner) RetrySleepFor(retry int) time.Duration {
+	d := r.RetrySleep.Duration
+	if r.Backoff == "exponential" {
+		f := float64(d) * math.Pow(r.Multiplier, float64(retry-1))
+		d = math.MaxInt64
+		if f < math.MaxInt64 {
+			d = time.Duration(f)
+		}
+	}
+	if r.MaxSleep.Duration > 0 && d > r.MaxSleep.Duration {
+		d = r.MaxSleep.Duration
+	}
+	return d
+}
+
+// validateRetry validates the retry settings of the Runner.
+func (r *Runner) validateRetry() error {
+	if r.Retries > 100 || r.Retries < 0 {
+		return fmt.Errorf("Runner(%s) had a Retries setting of %d, which exceeds the 100 maximum or is less than 0", r.Name, r.Retries)
+	}
+
+	r.Backoff = strings.TrimSpace(r.Backoff)
+	switch r.Backoff {
+	case "", "constant":
+		if r.Multiplier != 0 {
+			return fmt.Errorf("Runner(%s) had Multiplier set without Backoff = \"exponential\"", r.Name)
+		}
+	case "exponential":
+		if r.Multiplier == 0 {
+			r.Multiplier = 2
+		}
+		if r.Multiplier < 1 {
+			return fmt.Errorf("Runner(%s) had a Multiplier of %v, which must be at least 1", r.Name, r.Multiplier)
+		}
+	default:
+		return fmt.Errorf("Runner(%s) had Backoff(%s), which must be constant or exponential", r.Name, r.Backoff)
+	}
+	if r.Jitter < 0 || r.Jitter > 1 {
+		return fmt.Errorf("Runner(%s) had a Jitter of %v, which must be between 0 and 1", r.Name, r.Jitter)
+	}
+
+	for name, cond := range map[string]*RetryCond{"RetryOn": r.RetryOn, "NoRetryOn": r.NoRetryOn} {
+		if cond == nil {
+			continue
+		}
+		if err := cond.validate(); err != nil {
+			return fmt.Errorf("Runner(%s) %s %s", r.Name, name, err)
+		}
+	}
+
+	var total time.Duration
+	for i := 1; i <= r.Retries; i++ {
+		total += time.Duration(float64(r.RetrySleepFor(i)) * (1 + r.Jitter))
+		if total > maxRetrySleep || total < 0 {
+			return fmt.Errorf("Runner(%s) had retry settings that could sleep for more than our %s limit", r.Name, maxRetrySleep)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetrySleepFor(t *testing.T) {
+	tests := []struct {
+		desc   string
+		runner *Runner
+		want   []time.Duration
+	}{
+		{
+			desc:   "Constant",
+			runner: &Runner{RetrySleep: duration{time.Second}},
+			want:   []time.Duration{time.Second, time.Second, time.Second},
+		},
+		{
+			desc:   "Exponential",
+			runner: &Runner{RetrySleep: duration{time.Second}, Backoff: "exponential", Multiplier: 2},
+			want:   []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+		},
+		{
+			desc:   "Exponential with MaxSleep",
+			runner: &Runner{RetrySleep: duration{time.Second}, Backoff: "exponential", Multiplier: 3, MaxSleep: duration{5 * time.Second}},
+			want:   []time.Duration{time.Second, 3 * time.Second, 5 * time.Second, 5 * time.Second},
+		},
+	}
+
+	for _, test := range tests {
+		for i, want := range test.want {
+			if got := test.runner.RetrySleepFor(i + 1); got != want {
+				t.Errorf("TestRetrySleepFor(%s): retry(%d): got %v, want %v", test.desc, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestRetryCondMatch(t *testing.T) {
+	cond := &RetryCond{ExitCodes: []int{3}, Stderr: "throttled|429"}
+	if err := cond.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc   string
+		code   int
+		stderr string
+		want   string
+	}{
+		{desc: "Exit code", code: 3, want: "exit code(3)"},
+		{desc: "Stderr", code: 1, stderr: "error: 429 too many requests", want: "stderr matched(throttled|429)"},
+		{desc: "No match", code: 1, stderr: "not found"},
+	}
+
+	for _, test := range tests {
+		if got := cond.Match(test.code, nil, []byte(test.stderr), nil); got != test.want {
+			t.Errorf("TestRetryCondMatch(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestRetryValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		content string
+		wantErr bool
+	}{
+		{
+			desc: "Exponential",
+			content: `
+[[Seqs]]
+	Name = "Get"
+	Cmd = "ls"
+	Retries = 5
+	RetrySleep = "1s"
+	Backoff = "exponential"
+	MaxSleep = "10s"
+	Jitter = 0.2
+	[Seqs.RetryOn]
+		Stderr = "throttled|429"
+	[Seqs.NoRetryOn]
+		ExitCodes = [2]
+`,
+		},
+		{
+			desc: "Unknown Backoff",
+			content: `
+[[Seqs]]
+	Name = "Get"
+	Cmd = "ls"
+	Backoff = "linear"
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Multiplier without exponential",
+			content: `
+[[Seqs]]
+	Name = "Get"
+	Cmd = "ls"
+	Multiplier = 3.0
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Jitter too large",
+			content: `
+[[Seqs]]
+	Name = "Get"
+	Cmd = "ls"
+	Jitter = 1.5
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Bad regex",
+			content: `
+[[Seqs]]
+	Name = "Get"
+	Cmd = "ls"
+	[Seqs.RetryOn]
+		Stdout = "("
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Empty RetryOn",
+			content: `
+[[Seqs]]
+	Name = "Get"
+	Cmd = "ls"
+	[Seqs.RetryOn]
+`,
+			wantErr: true,
+		},
+		{
+			desc: "Sleeps too long",
+			content: `
+[[Seqs]]
+	Name = "Get"
+	Cmd = "ls"
+	Retries = 20
+	RetrySleep = "1s"
+	Backoff = "exponential"
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		readContent(t, test.desc, test.content, test.wantErr)
+	}
+}
@@ -0,0 +1,17 @@
+package config
+
+import (
+	_ "embed"
+)
+
+//go:generate go test -run TestSchema -update
+
+//go:embed schema.json
+var schema []byte
+
+// Schema returns the JSON Schema for config files. This can be given to editors to validate
+// and autocomplete configs written in YAML or JSON (or TOML with editors that support it).
+// It is generated from the types in this package with "go generate".
+func Schema() []byte {
+	return append([]byte(nil), schema...)
+}
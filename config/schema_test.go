@@ -0,0 +1,217 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Regenerates schema.json")
+
+func TestSchema(t *testing.T) {
+	docs, err := fieldDocs(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &schemaGen{docs: docs, defs: map[string]interface{}{}}
+	root := g.object(reflect.TypeOf(Config{}))
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["$id"] = "https://github.com/element-of-surprise/runme/config/schema.json"
+	root["title"] = "runme config"
+
+	refs := []interface{}{}
+	keys := map[reflect.Type][]string{}
+	for _, k := range seqKinds {
+		if keys[k.typ] == nil {
+			refs = append(refs, map[string]interface{}{"$ref": g.ref(k.typ)})
+		}
+		keys[k.typ] = append(keys[k.typ], k.key)
+	}
+	for typ, ks := range keys {
+		def := g.defs[typ.Name()].(map[string]interface{})
+		if len(ks) == 1 {
+			def["required"] = ks
+			continue
+		}
+		// A kind with more than one key must have exactly one of them.
+		one := []interface{}{}
+		for _, k := range ks {
+			one = append(one, map[string]interface{}{"required": []string{k}})
+		}
+		def["oneOf"] = one
+	}
+	g.defs["Seq"] = map[string]interface{}{
+		"description": "An entry in Seqs. The kind of entry is determined by its keys.",
+		"oneOf":       refs,
+	}
+	root["definitions"] = g.defs
+
+	b, err := json.MarshalIndent(root, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = append(b, '\n')
+
+	if *update {
+		if err := os.WriteFile("schema.json", b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if !bytes.Equal(b, Schema()) {
+		t.Errorf("TestSchema: schema.json is out of date, run: go generate ./config")
+	}
+}
+
+// schemaGen generates a JSON Schema from our types.
+type schemaGen struct {
+	// docs are the doc comments of our types, keyed by type name and then field name.
+	// The type's own doc is at the field name "".
+	docs map[string]map[string]string
+	defs map[string]interface{}
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// ref returns a reference to the definition for struct type "t", creating the definition if needed.
+func (g *schemaGen) ref(t reflect.Type) string {
+	if _, ok := g.defs[t.Name()]; !ok {
+		// Prevents recursion on types that reference themselves.
+		g.defs[t.Name()] = nil
+		g.defs[t.Name()] = g.object(t)
+	}
+	return "#/definitions/" + t.Name()
+}
+
+// object returns the schema for struct type "t".
+func (g *schemaGen) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	g.fields(t, props)
+
+	o := map[string]interface{}{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if d := g.docs[t.Name()][""]; d != "" {
+		o["description"] = d
+	}
+	return o
+}
+
+// fields adds the schema of each exported field of "t" to "props". Embedded structs have their fields added.
+func (g *schemaGen) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			g.fields(f.Type, props)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		s := g.typ(f.Type)
+		if d := g.docs[t.Name()][f.Name]; d != "" {
+			s["description"] = d
+		}
+		props[f.Name] = s
+	}
+}
+
+// typ returns the schema for type "t".
+func (g *schemaGen) typ(t reflect.Type) map[string]interface{} {
+	// A size can also be a number of bytes.
+	if t == reflect.TypeOf(size{}) {
+		return map[string]interface{}{"type": []string{"string", "integer"}}
+	}
+	if reflect.PtrTo(t).Implements(textUnmarshaler) {
+		return map[string]interface{}{"type": "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.typ(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		// Seqs are stored as generic maps until we know what kind they are.
+		if t.Elem().Kind() == reflect.Map && t.Elem().Elem().Kind() == reflect.Interface {
+			return map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": "#/definitions/Seq"}}
+		}
+		return map[string]interface{}{"type": "array", "items": g.typ(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.typ(t.Elem())}
+	case reflect.Struct:
+		return map[string]interface{}{"$ref": g.ref(t)}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	}
+	panic("schemaGen does not support type: " + t.String())
+}
+
+// fieldDocs parses the Go files in "dir" and returns the doc comments of all struct types and their fields.
+func fieldDocs(dir string) (map[string]map[string]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(
+		fset,
+		dir,
+		func(fi os.FileInfo) bool { return !strings.HasSuffix(fi.Name(), "_test.go") },
+		parser.ParseComments,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := map[string]map[string]string{}
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, decl := range f.Decls {
+				gd, ok := decl.(*ast.GenDecl)
+				if !ok || gd.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gd.Specs {
+					ts := spec.(*ast.TypeSpec)
+					st, ok := ts.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					m := map[string]string{"": docText(gd.Doc)}
+					if ts.Doc != nil {
+						m[""] = docText(ts.Doc)
+					}
+					for _, field := range st.Fields.List {
+						for _, name := range field.Names {
+							m[name.Name] = docText(field.Doc)
+						}
+					}
+					docs[ts.Name.Name] = m
+				}
+			}
+		}
+	}
+	return docs, nil
+}
+
+// docText turns a comment into a single line of text.
+func docText(cg *ast.CommentGroup) string {
+	if cg == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(cg.Text()), " ")
+}
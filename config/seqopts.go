@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// SeqOptions are options that every Runner, WriteFile, Call and Approve in Seqs has.
+type SeqOptions struct {
+	// OnFailure are Seqs that are run in order when this fails, such as to collect diagnostics. A failure of one
+	// does not stop the others and does not change where a resumed run starts. These cannot have their own OnFailure
+	// or use a Macro.
+	OnFailure []map[string]interface{}
+	// ContinueOnError lets the run continue when this fails, after its OnFailure Seqs are run. The failure is
+	// recorded as tolerated. This has no effect in OnFailure and Finally, which always continue.
+	ContinueOnError bool
+	// When is a template that must execute to "true" or "false", such as `{{ eq .Steps.Build.Status "Failed" }}`.
+	// If it is "false", this is skipped. The status of each step that has run is in {{ .Steps.Name.Status }} and is
+	// one of Succeeded, Failed, Tolerated or Skipped.
+	When string
+	// Tags are names for a group of steps, such as "network", that can be used to select which steps in Seqs run
+	// instead of naming each step.
+	Tags []string
+}
+
+// options returns the SeqOptions, which is how we get them from any type that embeds them.
+func (o *SeqOptions) options() *SeqOptions {
+	return o
+}
+
+// optioner is a type that embeds SeqOptions.
+type optioner interface {
+	options() *SeqOptions
+}
+
+// OnFailure returns the Sequences that are run when this Sequence fails.
+func (s *Sequence) OnFailure() []*Sequence {
+	return s.onFailure
+}
+
+// decodeOptions validates the SeqOptions of "item", if it has them, and stores its OnFailure Sequences in the Sequence.
+func (s *Sequence) decodeOptions(item interface{}) error {
+	o, ok := item.(optioner)
+	if !ok {
+		return nil
+	}
+	if o.options().When != "" {
+		if _, err := template.New("").Parse(o.options().When); err != nil {
+			return fmt.Errorf("When violated a text/template rule: %s", err)
+		}
+	}
+	for _, t := range o.options().Tags {
+		if strings.TrimSpace(t) != t || t == "" {
+			return fmt.Errorf("cannot have Tag(%s): is empty or has leading or trailing space", t)
+		}
+	}
+	for i, prim := range o.options().OnFailure {
+		f, err := decodeSeq(prim)
+		if err != nil {
+			return fmt.Errorf("OnFailure(%d) %s", i, err)
+		}
+		switch {
+		case f.useMacro != nil:
+			return fmt.Errorf("OnFailure(%d) cannot use a Macro", i)
+		case f.onFailure != nil:
+			return fmt.Errorf("OnFailure(%d) cannot have its own OnFailure", i)
+		}
+		s.onFailure = append(s.onFailure, f)
+	}
+	return nil
+}
+
+// ContinueOnError returns true if the run continues when this Sequence fails.
+func (s *Sequence) ContinueOnError() bool {
+	o, ok := s.Item().(optioner)
+	return ok && o.options().ContinueOnError
+}
+
+// Tags returns the Tags of the Sequence.
+func (s *Sequence) Tags() []string {
+	if o, ok := s.Item().(optioner); ok {
+		return o.options().Tags
+	}
+	return nil
+}
+
+// When executes the When template of the Sequence with "vals" and returns true if the Sequence should be run.
+// A Sequence without a When is always run.
+func (s *Sequence) When(vals map[string]string) (bool, error) {
+	o, ok := s.Item().(optioner)
+	if !ok || o.options().When == "" {
+		return true, nil
+	}
+	tmpl, err := template.New("").Parse(o.options().When)
+	if err != nil {
+		return false, fmt.Errorf("When violated a text/template rule: %s", err)
+	}
+	b := strings.Builder{}
+	if err := tmpl.Execute(&b, TemplateData(vals)); err != nil {
+		return false, fmt.Errorf("When: problem with template execution: %s", err)
+	}
+	switch strings.TrimSpace(b.String()) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("When executed to %q, which must be true or false", b.String())
+}
+
+// each calls "fn" on the Sequence and then on each of its OnFailure Sequences.
+func (s *Sequence) each(fn func(*Sequence) error) error {
+	if err := fn(s); err != nil {
+		return err
+	}
+	for _, f := range s.onFailure {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FinallySequences returns the Sequences in Finally, which are run after Seqs whether they succeeded or not.
+func (c *Config) FinallySequences() []*Sequence {
+	return c.finally
+}
+
+// allSequences returns every Sequence in Seqs and Finally along with their OnFailure Sequences.
+func (c *Config) allSequences() []*Sequence {
+	all := []*Sequence{}
+	for _, seqs := range [][]*Sequence{c.sequences, c.finally} {
+		for _, s := range seqs {
+			s.each(func(s *Sequence) error {
+				all = append(all, s)
+				return nil
+			})
+		}
+	}
+	return all
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestOnFailureAndFinally(t *testing.T) {
+	tests := []struct {
+		desc        string
+		files       map[string]string
+		wantSeqs    []string
+		wantOnFail  map[string][]string
+		wantFinally []string
+		wantErr     bool
+	}{
+		{
+			desc: "OnFailure and Finally",
+			files: map[string]string{
+				"config.toml": `
+Include = ["common.toml"]
+
+[[Seqs]]
+	Name = "Deploy"
+	Cmd = "az deployment create"
+	[[Seqs.OnFailure]]
+		Name = "Diagnose"
+		Cmd = "az aks show"
+	[[Seqs.OnFailure]]
+		Name = "SaveLogs"
+		Path = "logs.txt"
+		Value = "{{ .Logs }}"
+
+[[Finally]]
+	Name = "Cleanup"
+	Cmd = "rm -rf tmp"
+`,
+				"common.toml": `
+[[Macros]]
+	Name = "Logout"
+	Params = ["Account"]
+	[[Macros.Seqs]]
+		Name = "AzLogout"
+		Cmd = "az logout --username {% .Account %}"
+		[[Macros.Seqs.OnFailure]]
+			Name = "AzAccountClear"
+			Cmd = "az account clear {% .Account %}"
+
+[[Seqs]]
+	Name = "Login"
+	Cmd = "az login"
+
+[[Finally]]
+	Name = "Logout"
+	Macro = "Logout"
+	[Finally.Params]
+		Account = "me"
+`,
+			},
+			wantSeqs: []string{"Login", "Deploy"},
+			wantOnFail: map[string][]string{
+				"Deploy":          {"Diagnose", "SaveLogs"},
+				"Logout/AzLogout": {"Logout/AzAccountClear"},
+			},
+			wantFinally: []string{"Logout/AzLogout", "Cleanup"},
+		},
+		{
+			desc: "Nested OnFailure",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Deploy"
+	Cmd = "az deployment create"
+	[[Seqs.OnFailure]]
+		Name = "Diagnose"
+		Cmd = "az aks show"
+		[[Seqs.OnFailure.OnFailure]]
+			Name = "Again"
+			Cmd = "az aks show"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Macro in OnFailure",
+			files: map[string]string{
+				"config.toml": `
+[[Macros]]
+	Name = "Show"
+	[[Macros.Seqs]]
+		Name = "AksShow"
+		Cmd = "az aks show"
+
+[[Seqs]]
+	Name = "Deploy"
+	Cmd = "az deployment create"
+	[[Seqs.OnFailure]]
+		Name = "Diagnose"
+		Macro = "Show"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "OnFailure name is not unique",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Deploy"
+	Cmd = "az deployment create"
+	[[Seqs.OnFailure]]
+		Name = "Deploy"
+		Cmd = "az aks show"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Finally name is not unique",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Deploy"
+	Cmd = "az deployment create"
+
+[[Finally]]
+	Name = "Deploy"
+	Cmd = "rm -rf tmp"
+`,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		c, ok := readConfig(t, test.desc, writeFiles(t, test.files), "config.toml", nil, test.wantErr)
+		if !ok {
+			continue
+		}
+
+		seqs := []string{}
+		onFail := map[string][]string{}
+		for _, s := range append(c.Sequences(), c.FinallySequences()...) {
+			name := s.Item().(interface{ Sequence() string }).Sequence()
+			for _, f := range s.OnFailure() {
+				onFail[name] = append(onFail[name], f.Item().(interface{ Sequence() string }).Sequence())
+			}
+		}
+		for _, s := range c.Sequences() {
+			seqs = append(seqs, s.Item().(interface{ Sequence() string }).Sequence())
+		}
+		finally := []string{}
+		for _, s := range c.FinallySequences() {
+			finally = append(finally, s.Item().(interface{ Sequence() string }).Sequence())
+		}
+
+		if diff := pretty.Compare(test.wantSeqs, seqs); diff != "" {
+			t.Errorf("TestOnFailureAndFinally(%s): Seqs: -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantOnFail, onFail); diff != "" {
+			t.Errorf("TestOnFailureAndFinally(%s): OnFailure: -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantFinally, finally); diff != "" {
+			t.Errorf("TestOnFailureAndFinally(%s): Finally: -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
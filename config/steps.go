@@ -0,0 +1,157 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// StepsKey is the key in template data that holds the status of each step that has run, which can be used in
+// templates as {{ .Steps.Name.Status }}. A step whose name is not a valid template identifier, such as one in a
+// called config, can be used as {{ (index .Steps "Call/Name").Status }}.
+const StepsKey = "Steps"
+
+// StatusKey returns the key in the vals map that holds the status of the step "name". This is stored in our
+// vals so that a resumed run keeps the status of the steps run before it.
+func StatusKey(name string) string {
+	return StepsKey + "." + name + ".Status"
+}
+
+// reserved returns true if "k" is a key in the vals map that is set by runme.
+func reserved(k string) bool {
+	return k == WorkspaceKey || k == StepsKey || strings.HasPrefix(k, StepsKey+".")
+}
+
+// TemplateData returns the data that templates are executed with for "vals". The keys set with StatusKey are
+// moved to a map at StepsKey, so they can be used as {{ .Steps.Name.Status }}. If there are none, this is "vals".
+func TemplateData(vals map[string]string) interface{} {
+	steps := map[string]map[string]string{}
+	for k, v := range vals {
+		if !strings.HasPrefix(k, StepsKey+".") || !strings.HasSuffix(k, ".Status") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(k, StepsKey+"."), ".Status")
+		steps[name] = map[string]string{"Status": v}
+	}
+	if len(steps) == 0 {
+		return vals
+	}
+
+	data := make(map[string]interface{}, len(vals)+1)
+	for k, v := range vals {
+		if !reserved(k) || k == WorkspaceKey {
+			data[k] = v
+		}
+	}
+	data[StepsKey] = steps
+	return data
+}
+
+// Defines returns the keys in the vals map that the Sequence sets when it runs.
+func (s *Sequence) Defines() []string {
+	keys := []string{}
+	switch v := s.Item().(type) {
+	case *CreateVar:
+		keys = append(keys, v.Key)
+	case *Runner:
+		for _, k := range []string{v.ValueKey, v.StderrKey, v.ExitCodeKey} {
+			if k != "" {
+				keys = append(keys, k)
+			}
+		}
+		outputs := []string{}
+		for k := range v.Outputs {
+			outputs = append(outputs, k)
+		}
+		sort.Strings(outputs)
+		keys = append(keys, outputs...)
+	case *Call:
+		for k := range v.Outputs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+// Uses returns the keys in the vals map that the templates of the Sequence use, such as "Name" for {{ .Name }}.
+// This does not include the Workspace or the status of steps, which runme sets.
+func (s *Sequence) Uses() []string {
+	seen := map[string]bool{}
+	walkStrings(reflect.ValueOf(s.Item()), func(str string) (string, error) {
+		if !strings.Contains(str, "{{") {
+			return str, nil
+		}
+		t := parse.New("")
+		t.Mode = parse.SkipFuncCheck
+		if _, err := t.Parse(str, "", "", map[string]*parse.Tree{}); err != nil {
+			return str, nil
+		}
+		fields(t.Root, true, seen)
+		return str, nil
+	})
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		if !reserved(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fields adds the name of each field of the template data used in "node", such as "Name" for {{ .Name }},
+// to "seen". "root" is set if "." is the template data, which it is not inside the body of a range or with.
+// There, only fields of "$", such as {{ $.Name }}, are the template data's.
+func fields(node parse.Node, root bool, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			fields(c, root, seen)
+		}
+	case *parse.ActionNode:
+		fields(n.Pipe, root, seen)
+	case *parse.IfNode:
+		fields(&n.BranchNode, root, seen)
+	case *parse.RangeNode:
+		fields(n.Pipe, root, seen)
+		fields(n.List, false, seen)
+		fields(n.ElseList, root, seen)
+	case *parse.WithNode:
+		fields(n.Pipe, root, seen)
+		fields(n.List, false, seen)
+		fields(n.ElseList, root, seen)
+	case *parse.BranchNode:
+		fields(n.Pipe, root, seen)
+		fields(n.List, root, seen)
+		fields(n.ElseList, root, seen)
+	case *parse.TemplateNode:
+		fields(n.Pipe, root, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			fields(c, root, seen)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			fields(a, root, seen)
+		}
+	case *parse.ChainNode:
+		fields(n.Node, root, seen)
+	case *parse.FieldNode:
+		if root {
+			seen[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			seen[n.Ident[1]] = true
+		}
+	}
+}
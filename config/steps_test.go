@@ -0,0 +1,181 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestWhen(t *testing.T) {
+	content := `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "make"
+	ContinueOnError = true
+
+[[Seqs]]
+	Name = "Report"
+	Cmd = "echo {{ .Steps.Build.Status }}"
+	When = '{{ eq .Steps.Build.Status "Tolerated" }}'
+
+[[Seqs]]
+	Name = "Bad"
+	Cmd = "ls"
+	When = "{{ .Steps.Build.Status }}"
+`
+	wfs := simple.New()
+	if err := wfs.WriteFile("config.toml", []byte(content), 0600); err != nil {
+		panic(err)
+	}
+	c, err := FromFile(wfs, "config.toml", map[string]string{})
+	if err != nil {
+		t.Fatalf("TestWhen: got err == %s, want err == nil", err)
+	}
+	seqs := c.Sequences()
+	if !seqs[0].ContinueOnError() || seqs[1].ContinueOnError() {
+		t.Errorf("TestWhen: ContinueOnError was not decoded")
+	}
+
+	tests := []struct {
+		desc    string
+		seq     *Sequence
+		status  string
+		want    bool
+		wantErr bool
+	}{
+		{desc: "No When", seq: seqs[0], want: true},
+		{desc: "When true", seq: seqs[1], status: "Tolerated", want: true},
+		{desc: "When false", seq: seqs[1], status: "Succeeded"},
+		{desc: "When not a bool", seq: seqs[2], status: "Succeeded", wantErr: true},
+	}
+
+	for _, test := range tests {
+		vals := map[string]string{WorkspaceKey: "/tmp/ws"}
+		if test.status != "" {
+			vals[StatusKey("Build")] = test.status
+		}
+		got, err := test.seq.When(vals)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWhen(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWhen(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestWhen(%s): got %v, want %v", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestTemplateData(t *testing.T) {
+	vals := map[string]string{"Name": "aks", StatusKey("Build"): "Failed", StatusKey("Prod/Login"): "Succeeded"}
+
+	data, ok := TemplateData(vals).(map[string]interface{})
+	if !ok {
+		t.Fatalf("TestTemplateData: got %T, want map[string]interface{}", TemplateData(vals))
+	}
+	if data["Name"] != "aks" {
+		t.Errorf("TestTemplateData: got Name %v, want aks", data["Name"])
+	}
+	steps := data[StepsKey].(map[string]map[string]string)
+	if steps["Build"]["Status"] != "Failed" || steps["Prod/Login"]["Status"] != "Succeeded" {
+		t.Errorf("TestTemplateData: got Steps %v", steps)
+	}
+	if _, ok := data[StatusKey("Build")]; ok {
+		t.Errorf("TestTemplateData: status keys should only be in Steps")
+	}
+
+	plain := map[string]string{"Name": "aks"}
+	if _, ok := TemplateData(plain).(map[string]string); !ok {
+		t.Errorf("TestTemplateData: vals without statuses should be returned as is")
+	}
+}
+
+func TestReservedKeys(t *testing.T) {
+	content := `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "make"
+	ValueKey = "Steps.Build.Status"
+`
+	wfs := simple.New()
+	if err := wfs.WriteFile("config.toml", []byte(content), 0600); err != nil {
+		panic(err)
+	}
+	if _, err := FromFile(wfs, "config.toml", map[string]string{}); err == nil {
+		t.Errorf("TestReservedKeys: got err == nil, want err != nil")
+	}
+}
+
+func TestDefinesAndUses(t *testing.T) {
+	content := `
+[[Seqs]]
+	Name = "Group"
+	Cmd = "az group show -n {{ .Resc }}"
+	ValueKey = "Group"
+	ExitCodeKey = "GroupCode"
+	Tags = ["network"]
+
+[[Seqs]]
+	Name = "Subnet"
+	Shell = "sh"
+	Cmd = "{{ if .Debug }}set -x; {{ end }}echo {{ .Group }} {{ .Steps.Group.Status }} {{ .Workspace }}"
+	WorkDir = "{{ .Dir }}"
+	[Seqs.Env]
+		TOKEN = "{{ raw .Token }}"
+
+[[Seqs]]
+	Name = "Report"
+	Cmd = "echo {{ range .Steps }}{{ .Status }} {{ $.Region }}{{ end }} {{ with .Zone }}{{ .Name }}{{ else }}{{ .Default }}{{ end }}"
+`
+	wfs := simple.New()
+	if err := wfs.WriteFile("config.toml", []byte(content), 0600); err != nil {
+		panic(err)
+	}
+	c, err := FromFile(wfs, "config.toml", map[string]string{})
+	if err != nil {
+		t.Fatalf("TestDefinesAndUses: got err == %s, want err == nil", err)
+	}
+	seqs := c.Sequences()
+
+	if diff := pretty.Compare([]string{"Group", "GroupCode"}, seqs[0].Defines()); diff != "" {
+		t.Errorf("TestDefinesAndUses: Defines(): -want/+got:\n%s", diff)
+	}
+	if diff := pretty.Compare([]string{"Resc"}, seqs[0].Uses()); diff != "" {
+		t.Errorf("TestDefinesAndUses: Uses(): -want/+got:\n%s", diff)
+	}
+	if diff := pretty.Compare([]string{"network"}, seqs[0].Tags()); diff != "" {
+		t.Errorf("TestDefinesAndUses: Tags(): -want/+got:\n%s", diff)
+	}
+	if diff := pretty.Compare([]string{"Debug", "Dir", "Group", "Token"}, seqs[1].Uses()); diff != "" {
+		t.Errorf("TestDefinesAndUses: Uses(): -want/+got:\n%s", diff)
+	}
+	// Inside range and with, "." is not the template data, but "$" still is.
+	if diff := pretty.Compare([]string{"Default", "Region", "Zone"}, seqs[2].Uses()); diff != "" {
+		t.Errorf("TestDefinesAndUses: Uses() in range and with: -want/+got:\n%s", diff)
+	}
+}
+
+func TestSetupStepKeys(t *testing.T) {
+	content := `
+[[Seqs]]
+	Name = "Group"
+	Cmd = "az group show"
+	ValueKey = "Group"
+`
+	wfs := simple.New()
+	if err := wfs.WriteFile("config.toml", []byte(content), 0600); err != nil {
+		panic(err)
+	}
+	if _, err := FromFile(wfs, "config.toml", map[string]string{"Group": "rg"}); err != nil {
+		t.Errorf("TestSetupStepKeys(key set by a step): got err == %s, want err == nil", err)
+	}
+	if _, err := FromFile(wfs, "config.toml", map[string]string{"Other": "rg"}); err == nil {
+		t.Errorf("TestSetupStepKeys(unknown key): got err == nil, want err != nil")
+	}
+}
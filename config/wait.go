@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/element-of-surprise/runme/internal/jsonpath"
+)
+
+// defaultWaitInterval is the Interval of a WaitUntil that doesn't set one.
+const defaultWaitInterval = 10 * time.Second
+
+// WaitUntil re-runs the command of a Runner until it succeeds and its output satisfies all the conditions set.
+// With no conditions, this waits for the command to succeed.
+type WaitUntil struct {
+	// Interval is the time to wait between runs of the command. Defaults to 10s.
+	Interval duration
+	// Timeout is how long to wait before failing. A command that is still running at the Timeout is killed. (Required)
+	Timeout duration
+	// JSONPath is the path of a value in the stdout of the command, which must be JSON, such as "$.properties.principalId".
+	// If set, the other conditions are checked against this value instead of the whole stdout.
+	JSONPath string
+	// Equals is satisfied if the value equals this. This can contain template variables that reference keys stored
+	// in our val map.
+	Equals string
+	// Regex is satisfied if it matches the value.
+	Regex string
+	// NonEmpty is satisfied if the value is not empty after its space is trimmed.
+	NonEmpty bool
+
+	path  *jsonpath.Path
+	regex *regexp.Regexp
+}
+
+func (w *WaitUntil) validate() error {
+	if w.Timeout.Duration <= 0 {
+		return fmt.Errorf("WaitUntil must have a Timeout")
+	}
+	if w.Interval.Duration == 0 {
+		w.Interval.Duration = defaultWaitInterval
+	}
+	if w.Interval.Duration < 0 || w.Interval.Duration > w.Timeout.Duration {
+		return fmt.Errorf("WaitUntil had an Interval(%s) that must be between 0 and Timeout(%s)", w.Interval, w.Timeout)
+	}
+
+	w.JSONPath = strings.TrimSpace(w.JSONPath)
+	if w.JSONPath != "" {
+		p, err := jsonpath.Parse(w.JSONPath)
+		if err != nil {
+			return fmt.Errorf("WaitUntil had an invalid JSONPath: %s", err)
+		}
+		w.path = &p
+	}
+	if w.Regex != "" {
+		re, err := regexp.Compile(w.Regex)
+		if err != nil {
+			return fmt.Errorf("WaitUntil had an invalid Regex(%s): %s", w.Regex, err)
+		}
+		w.regex = re
+	}
+	return nil
+}
+
+// Check checks the stdout of a command that succeeded against the conditions. It returns the value the
+// conditions were checked against, which is the value at JSONPath if set, and if they were all satisfied.
+// If they weren't, "why" says which one wasn't. "equals" is Equals after template execution.
+func (w *WaitUntil) Check(stdout []byte, equals string) (value string, ok bool, why string) {
+	value = strings.TrimSpace(string(stdout))
+	if w.path != nil {
+		v, err := w.path.GetString(stdout)
+		if err != nil {
+			return value, false, fmt.Sprintf("JSONPath(%s): %s", w.JSONPath, err)
+		}
+		value = v
+	}
+
+	switch {
+	case w.Equals != "" && value != equals:
+		return value, false, fmt.Sprintf("value does not equal %q", equals)
+	case w.regex != nil && !w.regex.MatchString(value):
+		return value, false, fmt.Sprintf("value does not match Regex(%s)", w.Regex)
+	case w.NonEmpty && strings.TrimSpace(value) == "":
+		return value, false, "value is empty"
+	}
+	return value, true, ""
+}
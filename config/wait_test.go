@@ -0,0 +1,97 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitUntilCheck(t *testing.T) {
+	tests := []struct {
+		desc      string
+		wait      *WaitUntil
+		stdout    string
+		equals    string
+		wantValue string
+		wantOK    bool
+	}{
+		{
+			desc:      "No conditions",
+			wait:      &WaitUntil{},
+			stdout:    " anything\n",
+			wantValue: "anything",
+			wantOK:    true,
+		},
+		{
+			desc:   "NonEmpty with empty output",
+			wait:   &WaitUntil{NonEmpty: true},
+			stdout: "\n",
+		},
+		{
+			desc:      "JSONPath equals",
+			wait:      &WaitUntil{JSONPath: "$.properties.provisioningState", Equals: "{{ .State }}"},
+			stdout:    `{"properties": {"provisioningState": "Succeeded"}}`,
+			equals:    "Succeeded",
+			wantValue: "Succeeded",
+			wantOK:    true,
+		},
+		{
+			desc:      "JSONPath does not equal",
+			wait:      &WaitUntil{JSONPath: "$.properties.provisioningState", Equals: "Succeeded"},
+			stdout:    `{"properties": {"provisioningState": "Creating"}}`,
+			equals:    "Succeeded",
+			wantValue: "Creating",
+		},
+		{
+			desc:      "JSONPath missing",
+			wait:      &WaitUntil{JSONPath: "$.properties.principalId", NonEmpty: true},
+			stdout:    `{"properties": {}}`,
+			wantValue: `{"properties": {}}`,
+		},
+		{
+			desc:      "Regex",
+			wait:      &WaitUntil{Regex: "^[0-9a-f-]{36}$"},
+			stdout:    "6c3d5d2e-1f4a-4d7e-9a51-0c4e3b9f2a10\n",
+			wantValue: "6c3d5d2e-1f4a-4d7e-9a51-0c4e3b9f2a10",
+			wantOK:    true,
+		},
+	}
+
+	for _, test := range tests {
+		test.wait.Timeout = duration{time.Minute}
+		if err := test.wait.validate(); err != nil {
+			t.Errorf("TestWaitUntilCheck(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		value, ok, why := test.wait.Check([]byte(test.stdout), test.equals)
+		if ok != test.wantOK {
+			t.Errorf("TestWaitUntilCheck(%s): got ok == %v(%s), want %v", test.desc, ok, why, test.wantOK)
+		}
+		if value != test.wantValue {
+			t.Errorf("TestWaitUntilCheck(%s): got value %q, want %q", test.desc, value, test.wantValue)
+		}
+	}
+}
+
+func TestWaitUntilValidate(t *testing.T) {
+	tests := []struct {
+		desc    string
+		wait    *WaitUntil
+		wantErr bool
+	}{
+		{desc: "Default Interval", wait: &WaitUntil{Timeout: duration{time.Minute}}},
+		{desc: "No Timeout", wait: &WaitUntil{}, wantErr: true},
+		{desc: "Interval larger than Timeout", wait: &WaitUntil{Timeout: duration{time.Second}, Interval: duration{time.Minute}}, wantErr: true},
+		{desc: "Bad JSONPath", wait: &WaitUntil{Timeout: duration{time.Minute}, JSONPath: "$.a["}, wantErr: true},
+		{desc: "Bad Regex", wait: &WaitUntil{Timeout: duration{time.Minute}, Regex: "("}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := test.wait.validate()
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWaitUntilValidate(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWaitUntilValidate(%s): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// WorkspaceKey is the key in the vals map that holds the path of the run's Workspace, which can be used in
+// templates as {{ .Workspace }}. When it is set, Runners and WriteFiles use the Workspace as their
+// working directory unless they have a WorkDir.
+const WorkspaceKey = "Workspace"
+
+// WorkDir returns the directory for a WorkDir field "workDir", which can contain template variables that reference
+// keys stored in our val map. A relative WorkDir is relative to the Workspace. If "workDir" is empty, this is the
+// Workspace, which is "" if there isn't one.
+func WorkDir(workDir string, vals map[string]string) (string, error) {
+	workspace := vals[WorkspaceKey]
+	if strings.TrimSpace(workDir) == "" {
+		return workspace, nil
+	}
+
+	tmpl, err := template.New("").Parse(workDir)
+	if err != nil {
+		return "", fmt.Errorf("WorkDir(%s) violated a text/template rule: %s", workDir, err)
+	}
+	b := strings.Builder{}
+	if err := tmpl.Execute(&b, TemplateData(vals)); err != nil {
+		return "", fmt.Errorf("WorkDir(%s): problem with template execution: %s", workDir, err)
+	}
+	dir := b.String()
+	if workspace != "" && !filepath.IsAbs(dir) {
+		dir = filepath.Join(workspace, dir)
+	}
+	return dir, nil
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/gopherfs/fs/io/mem/simple"
+)
+
+func TestWorkDir(t *testing.T) {
+	tests := []struct {
+		desc    string
+		workDir string
+		vals    map[string]string
+		want    string
+		wantErr bool
+	}{
+		{desc: "No WorkDir or Workspace", want: ""},
+		{desc: "Workspace", vals: map[string]string{WorkspaceKey: "/ws"}, want: "/ws"},
+		{desc: "Relative WorkDir", workDir: "sub", vals: map[string]string{WorkspaceKey: "/ws"}, want: "/ws/sub"},
+		{desc: "Relative WorkDir without a Workspace", workDir: "sub", want: "sub"},
+		{desc: "Absolute WorkDir", workDir: "/other", vals: map[string]string{WorkspaceKey: "/ws"}, want: "/other"},
+		{
+			desc:    "Template",
+			workDir: "{{ .Workspace }}/{{ .Cluster }}",
+			vals:    map[string]string{WorkspaceKey: "/ws", "Cluster": "prod"},
+			want:    "/ws/prod",
+		},
+		{desc: "Bad template", workDir: "{{ .Cluster", wantErr: true},
+	}
+
+	for _, test := range tests {
+		vals := test.vals
+		if vals == nil {
+			vals = map[string]string{}
+		}
+		got, err := WorkDir(test.workDir, vals)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWorkDir(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWorkDir(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestWorkDir(%s): got %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestWriteFileWorkDir(t *testing.T) {
+	wfs := simple.New()
+	w := &WriteFile{Name: "Write", Path: "vnet.json", WorkDir: "net", Value: "{{ .Name }}"}
+	if err := w.Exec(wfs, map[string]string{WorkspaceKey: "ws", "Name": "vnet"}); err != nil {
+		t.Fatalf("TestWriteFileWorkDir: got err == %s", err)
+	}
+	b, err := fs.ReadFile(wfs, "ws/net/vnet.json")
+	if err != nil {
+		t.Fatalf("TestWriteFileWorkDir: file was not written to the WorkDir: %s", err)
+	}
+	if string(b) != "vnet" {
+		t.Errorf("TestWriteFileWorkDir: got %q, want %q", string(b), "vnet")
+	}
+}
@@ -0,0 +1,40 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/element-of-surprise/runme/config"
+)
+
+// ErrNeedsApproval is returned by Run, wrapped, when the run stopped at an Approve step that could not be approved.
+// FailedNode is the Approve step, so a resumed run starts by asking for approval again. The step is Paused and
+// Finally is not run.
+var ErrNeedsApproval = errors.New("needs approval")
+
+// ErrNotApproved is returned by Run, wrapped, when an Approve step was not approved or the Approver failed. It fails
+// the run even when it comes from a Call with ContinueOnError set.
+var ErrNotApproved = errors.New("not approved")
+
+// approve asks our Approver to approve "a".
+func (e *Executor) approve(a *config.Approve) error {
+	summary, err := a.Summary(e.vals)
+	if err != nil {
+		return err
+	}
+	summary = e.redact(summary)
+
+	if e.approver == nil {
+		return fmt.Errorf("Approve(%s): %w", a.Name, ErrNeedsApproval)
+	}
+	ok, err := e.approver(a.Name, summary)
+	switch {
+	case errors.Is(err, ErrNeedsApproval):
+		return fmt.Errorf("Approve(%s): %w", a.Name, err)
+	case err != nil:
+		return fmt.Errorf("Approve(%s): %w: %s", a.Name, ErrNotApproved, err)
+	case !ok:
+		return fmt.Errorf("Approve(%s): %w", a.Name, ErrNotApproved)
+	}
+	return nil
+}
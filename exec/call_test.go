@@ -0,0 +1,134 @@
+package exec
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// callFiles returns a config that calls child.toml, which calls grandchild.toml. The step Second in child.toml
+// runs "second".
+func callFiles(second string) map[string]string {
+	return map[string]string{
+		"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "echo built"
+	ValueKey = "Built"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+	[Seqs.Vals]
+		Input = "{{ .Built }}"
+	[Seqs.Outputs]
+		Result = "Lint"
+
+[[Seqs]]
+	Name = "After"
+	Cmd = "echo {{ .Result }}"
+	ValueKey = "Final"
+`,
+		"child.toml": `
+[[Required]]
+	Name = "Input"
+
+[[Seqs]]
+	Name = "First"
+	Cmd = "echo {{ .Input }}"
+	ValueKey = "First"
+
+[[Seqs]]
+	Name = "Second"
+	Cmd = "` + second + `"
+
+[[Seqs]]
+	Name = "Grandchild"
+	Config = "grandchild.toml"
+	[Seqs.Vals]
+		Input = "{{ .First }}"
+	[Seqs.Outputs]
+		Lint = "Lint"
+`,
+		"grandchild.toml": `
+[[Required]]
+	Name = "Input"
+
+[[Seqs]]
+	Name = "Lint"
+	Cmd = "echo linted {{ .Input }}"
+	ValueKey = "Lint"
+`,
+	}
+}
+
+func TestCall(t *testing.T) {
+	e, err := testRun(t, callFiles("true"))
+	if err != nil {
+		t.Fatalf("TestCall: got err == %s, want err == nil", err)
+	}
+
+	want := []string{
+		"Seqs: Build: Succeeded",
+		"Seqs: Child/First: Succeeded",
+		"Seqs: Child/Second: Succeeded",
+		"Seqs: Child/Grandchild/Lint: Succeeded",
+		"Seqs: Child/Grandchild: Succeeded",
+		"Seqs: Child: Succeeded",
+		"Seqs: After: Succeeded",
+	}
+	if diff := pretty.Compare(want, statuses(e)); diff != "" {
+		t.Errorf("TestCall: -want/+got:\n%s", diff)
+	}
+	if got := e.vals["Final"]; got != "linted built" {
+		t.Errorf("TestCall: got Final == %q, want %q", got, "linted built")
+	}
+	// Only the values in Outputs are copied back.
+	if _, ok := e.vals["First"]; ok {
+		t.Errorf("TestCall: a value of the called config that is not in Outputs was copied back")
+	}
+}
+
+func TestCallFailureAndResume(t *testing.T) {
+	e, err := testRun(t, callFiles("false"))
+	if err == nil {
+		t.Fatalf("TestCallFailureAndResume: got err == nil, want err != nil")
+	}
+	if !strings.HasPrefix(err.Error(), "Call(Child): ") {
+		t.Errorf("TestCallFailureAndResume: got err == %s, want it to start with Call(Child)", err)
+	}
+	if e.FailedNode() != "Child/Second" {
+		t.Errorf("TestCallFailureAndResume: got FailedNode %q, want %q", e.FailedNode(), "Child/Second")
+	}
+	want := []string{"Seqs: Build: Succeeded", "Seqs: Child/First: Succeeded", "Seqs: Child/Second: Failed", "Seqs: Child: Failed"}
+	if diff := pretty.Compare(want, statuses(e)); diff != "" {
+		t.Errorf("TestCallFailureAndResume: -want/+got:\n%s", diff)
+	}
+	// The called config's vals are stored so that a resume can restart inside the Call.
+	if got := e.vals["Child/First"]; got != "built" {
+		t.Errorf("TestCallFailureAndResume: got Child/First == %q, want %q", got, "built")
+	}
+
+	ran := []string{}
+	before := func(name string, vals map[string]string) (*Result, error) {
+		ran = append(ran, name)
+		return nil, nil
+	}
+	e, err = testResume(t, callFiles("true"), e.FailedNode(), e.vals, WithBeforeStep(before))
+	if err != nil {
+		t.Fatalf("TestCallFailureAndResume: resume got err == %s, want err == nil", err)
+	}
+	want = []string{"Child", "Child/Second", "Child/Grandchild", "Child/Grandchild/Lint", "After"}
+	if diff := pretty.Compare(want, ran); diff != "" {
+		t.Errorf("TestCallFailureAndResume: resume ran: -want/+got:\n%s", diff)
+	}
+	if got := e.vals["Final"]; got != "linted built" {
+		t.Errorf("TestCallFailureAndResume: got Final == %q, want %q", got, "linted built")
+	}
+	for k := range e.vals {
+		if strings.HasPrefix(k, "Child/") && !strings.HasPrefix(k, "Steps.") {
+			t.Errorf("TestCallFailureAndResume: the stored val(%s) of the Call was not removed", k)
+		}
+	}
+}
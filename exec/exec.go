@@ -1,13 +1,24 @@
 // Package exec provides an Executor type for executing a series of commands that
 // represent command line programs. This allows the creation of single purpose binaries
 // instead of the multipurpose runme binary program.
+//
+// Such a binary can use WithBeforeStep and WithAfterStep to add its own prompts, metrics or test doubles around
+// each step without changing the config, and WithFunc to run its own Go functions as steps.
 package exec
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
+	"text/template"
 
 	"github.com/element-of-surprise/runme/config"
 	"github.com/element-of-surprise/runme/internal/cmd"
@@ -30,19 +41,42 @@ type Executor struct {
 	vals map[string]string
 
 	seqs []*config.Sequence
+	// conf is the Config passed to Run.
+	conf *config.Config
 
 	failedNode string
+	// outcomes are the outcomes of the steps we ran.
+	outcomes []Outcome
+	// completed are the steps in Seqs with an Undo that completed.
+	completed []Completed
+
+	// opts are the options we were created with, which are passed on to the Executor of a config.Call.
+	opts      []Option
+	approver  Approver
+	selection Selection
+	stepper   Stepper
+	// beforeStep and afterStep are hooks called around each step.
+	beforeStep BeforeStep
+	afterStep  AfterStep
+	// funcs are the Funcs that Runners can run, by name.
+	funcs map[string]Func
+	// cmdOverride is the command a Stepper set for the attempt of the Runner being run.
+	cmdOverride string
 }
 
 // New creates a new Executor.
-func New(seqs []*config.Sequence, startAt string, fs ReadWriter, vals map[string]string) (*Executor, error) {
+func New(seqs []*config.Sequence, startAt string, fs ReadWriter, vals map[string]string, opts ...Option) (*Executor, error) {
 	if fs == nil {
 		return nil, fmt.Errorf("must pass a valid ReadWriter")
 	}
 	if vals == nil {
 		return nil, fmt.Errorf("must pass a valid vals map")
 	}
-	return &Executor{seqs: seqs, startAt: startAt, fs: fs, vals: vals}, nil
+	e := &Executor{seqs: seqs, startAt: startAt, fs: fs, vals: vals, opts: opts}
+	for _, o := range opts {
+		o(e)
+	}
+	return e, nil
 }
 
 type sequencer interface {
@@ -51,26 +85,262 @@ type sequencer interface {
 
 // Run runs the commands help in "c" and uses "vals" to do substiution for template arguments.
 func (e *Executor) Run(c *config.Config, vals map[string]string) error {
-	startAt := -1
+	e.conf = c
+	startAt, childStartAt, err := e.start()
+	if err != nil {
+		return err
+	}
+	selected, err := e.selected()
+	if err != nil {
+		return err
+	}
+	if err := e.undefined(startAt, selected); err != nil {
+		return err
+	}
+	if err := e.checkFuncs(e.seqs); err != nil {
+		return err
+	}
+	if c != nil {
+		if err := e.checkFuncs(c.FinallySequences()); err != nil {
+			return err
+		}
+	}
+
+	err = e.runSeqs(e.seqs[startAt:], selected[startAt:], childStartAt)
+	switch {
+	case c == nil:
+	case paused(err):
+		// Finally would tear down what the resumed run needs, it is run when the run finishes.
+		fmt.Printf("Skipping(%s): the run was paused, Finally runs when it is resumed\n", InFinally)
+	default:
+		e.runAll(c.FinallySequences(), InFinally)
+	}
+	return e.redactErr(err)
+}
+
+// start returns the index of the Sequence in our Seqs to start at. When StartAt is "[Call name]/[Sequence name]",
+// this also returns where to start inside the config.Call.
+func (e *Executor) start() (int, string, error) {
 	if e.startAt == "" {
-		startAt = 0
-	} else {
-		for i, seq := range e.seqs {
-			if e.startAt == seq.Item().(sequencer).Sequence() {
-				startAt = i
-				break
+		return 0, "", nil
+	}
+	for i, seq := range e.seqs {
+		name := seq.Item().(sequencer).Sequence()
+		if e.startAt == name {
+			return i, "", nil
+		}
+		if _, ok := seq.Item().(*config.Call); ok && strings.HasPrefix(e.startAt, name+"/") {
+			return i, strings.TrimPrefix(e.startAt, name+"/"), nil
+		}
+	}
+	return -1, "", fmt.Errorf("couldn't find the node to start at(%s)", e.startAt)
+}
+
+// runSeqs runs "seqs" in order, skipping those that are not "selected". "childStartAt" is where to start inside
+// the first Sequence if it is a config.Call. When a Sequence fails, its OnFailure Sequences are run and we stop,
+// unless it has ContinueOnError set and was not stopped by an Approve step that was not approved. When a Sequence
+// pauses the run, we stop without running its OnFailure.
+func (e *Executor) runSeqs(seqs []*config.Sequence, selected []bool, childStartAt string) error {
+	for i, node := range seqs {
+		if i > 0 {
+			childStartAt = ""
+		}
+		name := node.Item().(sequencer).Sequence()
+		if !selected[i] {
+			fmt.Printf("Skipping(%s): %s: not selected\n", InSeqs, name)
+			e.record(name, InSeqs, Skipped, nil)
+			continue
+		}
+		run, err := e.when(node, name, InSeqs)
+		if err != nil {
+			e.failedNode = name
+			return err
+		}
+		if !run {
+			continue
+		}
+
+		failedNode := e.failedNode
+		skipped, err := e.stepRun(node, name, childStartAt)
+		if skipped {
+			e.failedNode = failedNode
+			e.record(name, InSeqs, Skipped, nil)
+			continue
+		}
+		// A config.Call sets the failed node itself, which may be inside the called config.
+		_, isCall := node.Item().(*config.Call)
+		if paused(err) {
+			if !isCall {
+				e.failedNode = name
 			}
+			e.record(name, InSeqs, Paused, err)
+			return err
+		}
+		// A step that was not approved, such as in a Call, must stop the steps that rely on the approval.
+		tolerate := node.ContinueOnError() && !errors.Is(err, ErrNotApproved)
+		e.record(name, InSeqs, status(err, tolerate), err)
+		if r, ok := node.Item().(*config.Runner); ok && err == nil {
+			e.complete(r)
+		}
+		if err != nil {
+			if !isCall {
+				e.failedNode = name
+			}
+			e.runAll(node.OnFailure(), InOnFailure)
+			if tolerate {
+				e.failedNode = failedNode
+				e.warnf(name, "failed, continuing because of ContinueOnError: %s", err)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// runAll runs all of "seqs" for "stage", even if some of them fail. Failures are printed and recorded in
+// our Outcomes, but do not change our FailedNode.
+func (e *Executor) runAll(seqs []*config.Sequence, stage Stage) {
+	failedNode := e.failedNode
+	for _, node := range seqs {
+		name := node.Item().(sequencer).Sequence()
+		run, err := e.when(node, name, stage)
+		if err != nil {
+			e.warnf(name, "%s step failed: %s", stage, err)
+			continue
+		}
+		if !run {
+			continue
+		}
+		fmt.Printf("Running(%s): %s\n", stage, name)
+		err = e.runSeq(node, stage, "")
+		if errors.Is(err, ErrSkipStep) {
+			e.record(name, stage, Skipped, nil)
+			continue
+		}
+		e.record(name, stage, status(err, false), err)
+		if err != nil {
+			e.warnf(name, "%s step failed: %s", stage, err)
+		}
+	}
+	e.failedNode = failedNode
+}
+
+// when returns true if "node", named "name", should be run for "stage" because of its When. A node that is not
+// run is recorded as Skipped, or as Failed if its When has an error.
+func (e *Executor) when(node *config.Sequence, name string, stage Stage) (bool, error) {
+	run, err := node.When(e.vals)
+	if err != nil {
+		err = fmt.Errorf("step(%s) %w", name, err)
+		e.record(name, stage, Failed, err)
+		return false, err
+	}
+	if !run {
+		fmt.Printf("Skipping(%s): %s: When was false\n", stage, name)
+		e.record(name, stage, Skipped, nil)
+	}
+	return run, nil
+}
+
+// runSeq runs a single Sequence for "stage", with our BeforeStep and AfterStep around it. "childStartAt" is where
+// to start inside it if it is a config.Call. If our BeforeStep skips it, this returns ErrSkipStep.
+func (e *Executor) runSeq(node *config.Sequence, stage Stage, childStartAt string) error {
+	name := node.Item().(sequencer).Sequence()
+	failedNode := e.failedNode
+
+	res, err := e.before(name)
+	switch {
+	case errors.Is(err, ErrSkipStep):
+		fmt.Printf("Skipping(%s): %s: skipped by BeforeStep\n", stage, name)
+		return err
+	case err != nil:
+	case res != nil:
+		err = e.inject(node, name, res)
+	default:
+		if call, ok := node.Item().(*config.Call); ok {
+			err = e.call(call, childStartAt)
+		} else {
+			err = e.run(node)
 		}
 	}
-	if startAt == -1 {
-		return fmt.Errorf("couldn't find the node to start at(%s)", e.startAt)
+
+	err = e.after(name, err)
+	if err == nil {
+		// AfterStep can make a failed config.Call succeed, which has already set the failed node.
+		e.failedNode = failedNode
 	}
+	return err
+}
+
+// call runs a config.Call. If startAt is set, we are resuming inside the called config and its vals
+// are restored from the ones we stored in our vals when it failed.
+func (e *Executor) call(call *config.Call, startAt string) error {
+	fmt.Println("Executing(Call): ", call.Name)
 
-	for _, node := range e.seqs[startAt:] {
-		if err := e.run(node); err != nil {
-			e.failedNode = node.Item().(sequencer).Sequence()
+	prefix := call.Name + "/"
+	var childVals map[string]string
+	if startAt != "" {
+		childVals = map[string]string{}
+		for k, v := range e.vals {
+			if strings.HasPrefix(k, prefix) {
+				childVals[strings.TrimPrefix(k, prefix)] = v
+			}
+		}
+	} else {
+		var err error
+		childVals, err = call.ChildVals(e.vals)
+		if err != nil {
+			e.failedNode = call.Name
 			return err
 		}
+		// A called config shares our Workspace.
+		if ws, ok := e.vals[config.WorkspaceKey]; ok {
+			childVals[config.WorkspaceKey] = ws
+		}
+		if err := call.Child().Setup(e.fs, childVals); err != nil {
+			e.failedNode = call.Name
+			return fmt.Errorf("Call(%s): %w", call.Name, err)
+		}
+	}
+
+	child, err := New(call.Child().Sequences(), startAt, e.fs, childVals, e.childOptions(call.Name)...)
+	if err != nil {
+		e.failedNode = call.Name
+		return err
+	}
+
+	// Remove any vals stored from a previous failure of the Call.
+	for k := range e.vals {
+		if strings.HasPrefix(k, prefix) {
+			delete(e.vals, k)
+		}
+	}
+
+	err = child.Run(call.Child(), childVals)
+	for _, o := range child.Outcomes() {
+		o.Name = prefix + o.Name
+		e.outcomes = append(e.outcomes, o)
+		e.vals[config.StatusKey(o.Name)] = string(o.Status)
+	}
+	for _, c := range child.Completed() {
+		c.Name = prefix + c.Name
+		e.completed = append(e.completed, c)
+	}
+	if err != nil {
+		// Store the called config's vals so that a resume can restart inside the Call.
+		for k, v := range childVals {
+			e.vals[prefix+k] = v
+		}
+		e.failedNode = call.Name
+		if child.FailedNode() != "" {
+			e.failedNode = prefix + child.FailedNode()
+		}
+		return fmt.Errorf("Call(%s): %w", call.Name, err)
+	}
+
+	if err := call.Output(childVals, e.vals); err != nil {
+		e.failedNode = call.Name
+		return err
 	}
 	return nil
 }
@@ -87,45 +357,312 @@ func (e *Executor) run(r *config.Sequence) error {
 		if err := v.Exec(e.fs, e.vals); err != nil {
 			return err
 		}
+	case *config.Approve:
+		fmt.Println("Executing(Approve): ", v.Name)
+		if err := e.approve(v); err != nil {
+			return err
+		}
 	case *config.WriteFile:
 		fmt.Println("Executing(WriteFile): ", v.Name)
 		if err := v.Exec(e.fs, e.vals); err != nil {
 			return err
 		}
 	case *config.Runner:
-		c, err := cmd.New(v.Cmd, e.vals)
+		c, details, err := e.runnerCmd(v)
 		if err != nil {
 			return err
 		}
-		fmt.Printf("Executing(Runner): %s: %s\n", v.Name, c.String())
+		if v.Func != "" {
+			fmt.Printf("Executing(Func): %s: %s\n", v.Name, v.Func)
+		} else {
+			fmt.Printf("Executing(Runner): %s: %s\n", v.Name, e.redact(c.String()))
+		}
+		for _, d := range details {
+			fmt.Printf("\t%s\n", d)
+		}
 		if v.Sleep.Duration > 0 {
 			fmt.Println("Sleeping for: ", v.Sleep.Duration)
 		}
-		var b []byte
-		for i := 0; i < v.Retries+1; i++ {
-			if i > 0 {
-				fmt.Printf("Sleeping for %v between retries", v.RetrySleep.Duration)
-				time.Sleep(v.RetrySleep.Duration)
-				c, err = cmd.New(v.Cmd, e.vals)
-				if err != nil {
-					return err
-				}
-			}
-			b, err = c.Run()
-			if err != nil {
-				fmt.Println("cmd returned error: ", err)
-				continue
-			}
-			break
+		var out cmd.Output
+		if v.WaitUntil != nil {
+			out, err = e.wait(v, c)
+		} else {
+			out, err = e.retry(v, c)
 		}
+		// The output is stored even if the Runner failed, so that its OnFailure can use it.
+		e.store(v, out)
 		if err != nil {
 			return err
 		}
-		if v.ValueKey != "" {
-			e.vals[v.ValueKey] = strings.TrimSpace(string(b))
+		if err := e.outputs(v, out); err != nil {
+			return err
 		}
 	default:
 		return fmt.Errorf("Executor received a node of type(%T) that we do not support", v)
 	}
 	return nil
 }
+
+// store stores the output of Runner "r" in its ValueKey, StderrKey and ExitCodeKey.
+func (e *Executor) store(r *config.Runner, out cmd.Output) {
+	if r.ValueKey != "" {
+		e.vals[r.ValueKey] = strings.TrimSpace(string(out.Stdout))
+		if out.StdoutFile != "" {
+			e.vals[r.ValueKey] = out.StdoutFile
+		}
+	}
+	if r.StderrKey != "" {
+		e.vals[r.StderrKey] = strings.TrimSpace(string(out.Stderr))
+		if out.StderrFile != "" {
+			e.vals[r.StderrKey] = out.StderrFile
+		}
+	}
+	if r.ExitCodeKey != "" {
+		e.vals[r.ExitCodeKey] = strconv.Itoa(out.ExitCode)
+	}
+}
+
+// runnerCmd creates the Cmd for a Runner, which may be a Cmd, a Cmd run by a Shell or a Pipeline. It also returns
+// details about how the Cmd is run to print, such as the environment variables set by Env tables. Secrets in the
+// details are redacted. A Runner with a Func has no Cmd.
+func (e *Executor) runnerCmd(r *config.Runner) (*cmd.Cmd, []string, error) {
+	if r.Func != "" {
+		return nil, nil, nil
+	}
+	c, err := e.baseCmd(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conf := e.conf
+	if conf == nil {
+		conf = &config.Config{}
+	}
+	env, set, err := conf.Environ(r, e.vals, os.Environ())
+	if err != nil {
+		return nil, nil, fmt.Errorf("Runner(%s): %w", r.Name, err)
+	}
+	c.ClearEnv().Env(env...)
+
+	details := []string{}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		details = append(details, fmt.Sprintf("Env: %s=%s", k, e.redact(set[k])))
+	}
+
+	dir, err := config.WorkDir(r.WorkDir, e.vals)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Runner(%s): %w", r.Name, err)
+	}
+	if dir != "" {
+		if mk, ok := e.fs.(gfs.MkdirAllFS); ok {
+			if err := mk.MkdirAll(dir, 0700); err != nil {
+				return nil, nil, fmt.Errorf("Runner(%s): could not create WorkDir: %w", r.Name, err)
+			}
+		}
+		c.Dir(dir)
+	}
+
+	if r.MaxOutput.Bytes > 0 {
+		spill := ""
+		if r.OnMaxOutput == "spill" {
+			spill, err = e.outputPath(r)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Runner(%s): %w", r.Name, err)
+			}
+		}
+		c.Limit(r.MaxOutput.Bytes, spill)
+	}
+
+	stdin, detail, err := e.stdin(r, dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Runner(%s): %w", r.Name, err)
+	}
+	if stdin != nil {
+		c.Stdin(stdin)
+		details = append(details, detail)
+	}
+	return c, details, nil
+}
+
+// baseCmd creates the Cmd for a Runner from its Cmd, Shell or Pipeline, without the settings runnerCmd adds. If a
+// Stepper changed the command, the Cmd is made from that instead.
+func (e *Executor) baseCmd(r *config.Runner) (*cmd.Cmd, error) {
+	data := config.TemplateData(e.vals)
+	switch {
+	case e.cmdOverride != "" && r.Pipeline != nil:
+		return cmd.ParsePipeline(e.cmdOverride, data)
+	case e.cmdOverride != "":
+		return cmd.New(e.cmdOverride, data)
+	case r.Pipeline != nil:
+		return cmd.NewPipeline(r.Pipeline, data)
+	case r.Shell != "":
+		return cmd.NewShell(r.Shell, r.Cmd, data)
+	}
+	return cmd.New(r.Cmd, data)
+}
+
+// checkOutput returns an error if Runner "r" fails because its output was larger than MaxOutput. Otherwise
+// it warns about any output that was truncated or written to a file.
+func (e *Executor) checkOutput(r *config.Runner, out cmd.Output) error {
+	for _, o := range []struct {
+		name      string
+		truncated bool
+		file      string
+	}{
+		{"stdout", out.StdoutTruncated, out.StdoutFile},
+		{"stderr", out.StderrTruncated, out.StderrFile},
+	} {
+		switch {
+		case o.truncated && r.OnMaxOutput == "fail":
+			return fmt.Errorf("Runner(%s): %s was larger than MaxOutput(%d bytes)", r.Name, o.name, r.MaxOutput.Bytes)
+		case o.truncated:
+			e.warnf(r.Name, "%s was larger than MaxOutput(%d bytes) and was truncated", o.name, r.MaxOutput.Bytes)
+		case o.file != "":
+			e.warnf(r.Name, "%s was larger than MaxOutput(%d bytes) and was written to file(%s)", o.name, r.MaxOutput.Bytes, o.file)
+		}
+	}
+	return nil
+}
+
+// runCmd runs the Cmd "c" for Runner "r", which is killed if "ctx" is done first. An Interactive Runner is run in
+// a pseudo-terminal with its transcript written to a file, and is not killed. A Runner with a Func runs it with "ctx"
+// instead.
+func (e *Executor) runCmd(ctx context.Context, r *config.Runner, c *cmd.Cmd) (cmd.Output, error) {
+	switch {
+	case r.Func != "":
+		return e.runFunc(ctx, r)
+	case !r.Interactive:
+		return c.RunContext(ctx)
+	}
+
+	p, err := e.outputPath(r)
+	if err != nil {
+		return cmd.Output{ExitCode: -1}, fmt.Errorf("Runner(%s): %w", r.Name, err)
+	}
+	p += ".transcript"
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return cmd.Output{ExitCode: -1}, fmt.Errorf("Runner(%s): could not create transcript file: %w", r.Name, err)
+	}
+	defer f.Close()
+	fmt.Printf("\tInteractive: transcript at %s\n", p)
+
+	out, err := c.RunInteractive(f)
+	if errors.Is(err, cmd.ErrNotTerminal) {
+		return out, fmt.Errorf("Runner(%s) is Interactive: %w", r.Name, err)
+	}
+	return out, err
+}
+
+// outputPath returns the path, without extension, of the files that the output of Runner "r" is written
+// to, such as when it is larger than MaxOutput. These are in the Workspace, or the temp directory if there isn't one.
+func (e *Executor) outputPath(r *config.Runner) (string, error) {
+	dir := e.vals[config.WorkspaceKey]
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	dir = filepath.Join(dir, "output")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("could not create directory for output files: %w", err)
+	}
+	return filepath.Join(dir, unsafeChars.ReplaceAllString(r.Name, "_")), nil
+}
+
+// unsafeChars are characters we don't put in file names.
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// warnf prints a warning about the Sequence "name".
+func (e *Executor) warnf(name string, format string, a ...interface{}) {
+	fmt.Printf("Warning: %s: %s\n", name, e.redact(fmt.Sprintf(format, a...)))
+}
+
+// allowed returns true if "code" is one of the "allowed" exit codes.
+func allowed(allowed []int, code int) bool {
+	for _, a := range allowed {
+		if a == code {
+			return true
+		}
+	}
+	return false
+}
+
+// maxStdinDetail is the most of a Stdin we print.
+const maxStdinDetail = 200
+
+// maxValueDetail is the most of a value checked by Expect or WaitUntil that we print.
+const maxValueDetail = 200
+
+// stdin returns the reader for the stdin of Runner "r", which is nil if it has no stdin, and a detail
+// to print about it. "dir" is the Runner's working directory.
+func (e *Executor) stdin(r *config.Runner, dir string) (io.Reader, string, error) {
+	switch {
+	case r.Stdin != "":
+		tmpl, err := template.New("").Parse(r.Stdin)
+		if err != nil {
+			return nil, "", fmt.Errorf("Stdin violated a text/template rule: %s", err)
+		}
+		b := strings.Builder{}
+		if err := tmpl.Execute(&b, config.TemplateData(e.vals)); err != nil {
+			return nil, "", fmt.Errorf("Stdin: problem with template execution: %s", err)
+		}
+		detail := e.redact(b.String())
+		if len(detail) > maxStdinDetail {
+			detail = detail[:maxStdinDetail] + "..."
+		}
+		return strings.NewReader(b.String()), fmt.Sprintf("Stdin: %q", detail), nil
+	case r.StdinFrom != "":
+		if v, ok := e.vals[r.StdinFrom]; ok {
+			return strings.NewReader(v), fmt.Sprintf("Stdin: from key(%s)", r.StdinFrom), nil
+		}
+		p := r.StdinFrom
+		if dir != "" && !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		f, err := e.fs.Open(p)
+		if err != nil {
+			return nil, "", fmt.Errorf("StdinFrom(%s) is not a key and could not be opened as a file: %w", r.StdinFrom, err)
+		}
+		return f, fmt.Sprintf("Stdin: from file(%s)", p), nil
+	}
+	return nil, "", nil
+}
+
+// redact replaces any values in "s" that are secrets with "[redacted]".
+func (e *Executor) redact(s string) string {
+	if e.conf == nil {
+		return s
+	}
+	return e.conf.Redact(e.vals, s)
+}
+
+// redactErr returns "err" with any values that are secrets replaced with "[redacted]" in its message. It still
+// wraps "err", so errors.Is and errors.As work with it.
+func (e *Executor) redactErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := e.redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// redactedError is an error whose message has had its secrets redacted.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (r *redactedError) Error() string {
+	return r.msg
+}
+
+func (r *redactedError) Unwrap() error {
+	return r.err
+}
@@ -0,0 +1,214 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// testRun writes "files" to a file system, reads the config in "config.toml" and runs it with "opts". It returns
+// the Executor and the error from Run.
+func testRun(t *testing.T, files map[string]string, opts ...Option) (*Executor, error) {
+	t.Helper()
+
+	wfs := simple.New()
+	for p, content := range files {
+		if err := wfs.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatalf("could not write file(%s): %s", p, err)
+		}
+	}
+	vals := map[string]string{}
+	c, err := config.FromFile(wfs, "config.toml", vals)
+	if err != nil {
+		t.Fatalf("could not read the config: %s", err)
+	}
+	e, err := New(c.Sequences(), "", wfs, vals, opts...)
+	if err != nil {
+		t.Fatalf("could not create the Executor: %s", err)
+	}
+	return e, e.Run(c, vals)
+}
+
+// testResume is testRun for a run that resumes at "startAt" with the "vals" saved by the run that failed.
+func testResume(t *testing.T, files map[string]string, startAt string, vals map[string]string, opts ...Option) (*Executor, error) {
+	t.Helper()
+
+	wfs := simple.New()
+	for p, content := range files {
+		if err := wfs.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatalf("could not write file(%s): %s", p, err)
+		}
+	}
+	c, err := config.FromFile(wfs, "config.toml", map[string]string{})
+	if err != nil {
+		t.Fatalf("could not read the config: %s", err)
+	}
+	e, err := New(c.Sequences(), startAt, wfs, vals, opts...)
+	if err != nil {
+		t.Fatalf("could not create the Executor: %s", err)
+	}
+	return e, e.Run(c, vals)
+}
+
+// statuses returns the outcomes of "e" as "[stage]: [name]: [status]".
+func statuses(e *Executor) []string {
+	s := []string{}
+	for _, o := range e.Outcomes() {
+		s = append(s, fmt.Sprintf("%s: %s: %s", o.Stage, o.Name, o.Status))
+	}
+	return s
+}
+
+func TestPause(t *testing.T) {
+	const content = `
+[[Seqs]]
+	Name = "Create"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "ApproveDelete"
+	Approve = "Delete the old cluster"
+
+[[Seqs]]
+	Name = "Delete"
+	Cmd = "true"
+
+[[Finally]]
+	Name = "Logout"
+	Cmd = "true"
+`
+
+	tests := []struct {
+		desc           string
+		opts           []Option
+		wantErr        error
+		wantFailedNode string
+		wantStatuses   []string
+	}{
+		{
+			desc:           "Needs approval",
+			wantErr:        ErrNeedsApproval,
+			wantFailedNode: "ApproveDelete",
+			wantStatuses:   []string{"Seqs: Create: Succeeded", "Seqs: ApproveDelete: Paused"},
+		},
+		{
+			desc: "Quit",
+			opts: []Option{
+				WithApprover(func(name, summary string) (bool, error) { return true, nil }),
+				WithStepper(func(s *Step) (Action, error) {
+					if s.Name == "Delete" {
+						return Quit, nil
+					}
+					return Continue, nil
+				}),
+			},
+			wantErr:        ErrQuit,
+			wantFailedNode: "Delete",
+			wantStatuses:   []string{"Seqs: Create: Succeeded", "Seqs: ApproveDelete: Succeeded", "Seqs: Delete: Paused"},
+		},
+		{
+			desc: "Not approved runs Finally",
+			opts: []Option{
+				WithApprover(func(name, summary string) (bool, error) { return false, nil }),
+			},
+			wantFailedNode: "ApproveDelete",
+			wantStatuses:   []string{"Seqs: Create: Succeeded", "Seqs: ApproveDelete: Failed", "Finally: Logout: Succeeded"},
+		},
+	}
+
+	for _, test := range tests {
+		e, err := testRun(t, map[string]string{"config.toml": content}, test.opts...)
+		switch {
+		case err == nil:
+			t.Errorf("TestPause(%s): got err == nil, want err != nil", test.desc)
+		case test.wantErr != nil && !errors.Is(err, test.wantErr):
+			t.Errorf("TestPause(%s): got err == %s, want %s", test.desc, err, test.wantErr)
+		}
+		if e.FailedNode() != test.wantFailedNode {
+			t.Errorf("TestPause(%s): got FailedNode %q, want %q", test.desc, e.FailedNode(), test.wantFailedNode)
+		}
+		if diff := pretty.Compare(test.wantStatuses, statuses(e)); diff != "" {
+			t.Errorf("TestPause(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestContinueOnErrorApproval(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `
+[[Seqs]]
+	Name = "Prepare"
+	Config = "prepare.toml"
+	ContinueOnError = true
+
+[[Seqs]]
+	Name = "Cutover"
+	Cmd = "true"
+`,
+		"prepare.toml": `
+[[Seqs]]
+	Name = "Drain"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "ApproveCutover"
+	Approve = "Move traffic to the new cluster"
+`,
+	}
+
+	tests := []struct {
+		desc         string
+		opts         []Option
+		wantErr      error
+		wantStatuses []string
+	}{
+		{
+			desc:         "Needs approval",
+			wantErr:      ErrNeedsApproval,
+			wantStatuses: []string{"Seqs: Prepare/Drain: Succeeded", "Seqs: Prepare/ApproveCutover: Paused", "Seqs: Prepare: Paused"},
+		},
+		{
+			desc: "Not approved",
+			opts: []Option{
+				WithApprover(func(name, summary string) (bool, error) { return false, nil }),
+			},
+			wantErr:      ErrNotApproved,
+			wantStatuses: []string{"Seqs: Prepare/Drain: Succeeded", "Seqs: Prepare/ApproveCutover: Failed", "Seqs: Prepare: Failed"},
+		},
+		{
+			desc: "Approver failed",
+			opts: []Option{
+				WithApprover(func(name, summary string) (bool, error) { return false, errors.New("no terminal") }),
+			},
+			wantErr:      ErrNotApproved,
+			wantStatuses: []string{"Seqs: Prepare/Drain: Succeeded", "Seqs: Prepare/ApproveCutover: Failed", "Seqs: Prepare: Failed"},
+		},
+		{
+			desc: "Approved",
+			opts: []Option{
+				WithApprover(func(name, summary string) (bool, error) { return true, nil }),
+			},
+			wantStatuses: []string{"Seqs: Prepare/Drain: Succeeded", "Seqs: Prepare/ApproveCutover: Succeeded", "Seqs: Prepare: Succeeded", "Seqs: Cutover: Succeeded"},
+		},
+	}
+
+	for _, test := range tests {
+		e, err := testRun(t, files, test.opts...)
+		switch {
+		case test.wantErr == nil && err != nil:
+			t.Errorf("TestContinueOnErrorApproval(%s): got err == %s, want err == nil", test.desc, err)
+		case test.wantErr != nil && !errors.Is(err, test.wantErr):
+			t.Errorf("TestContinueOnErrorApproval(%s): got err == %v, want %s", test.desc, err, test.wantErr)
+		}
+		if test.wantErr != nil && e.FailedNode() != "Prepare/ApproveCutover" {
+			t.Errorf("TestContinueOnErrorApproval(%s): got FailedNode %q, want %q", test.desc, e.FailedNode(), "Prepare/ApproveCutover")
+		}
+		if diff := pretty.Compare(test.wantStatuses, statuses(e)); diff != "" {
+			t.Errorf("TestContinueOnErrorApproval(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
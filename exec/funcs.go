@@ -0,0 +1,97 @@
+package exec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/element-of-surprise/runme/internal/cmd"
+)
+
+// Func is a Go function that a Runner with Func set runs instead of a command. It is given a copy of the vals and
+// returns outputs, which the Runner's Outputs store in the vals. "ctx" is cancelled when a WaitUntil times out.
+//
+// The outputs are the stdout of the Runner as a JSON object, which is stored at ValueKey and checked by Expect and
+// WaitUntil. An error is the stderr of the Runner with an exit code of 1, which RetryOn and NoRetryOn can match.
+type Func func(ctx context.Context, vals map[string]string) (map[string]string, error)
+
+// WithFunc registers "f" as "name", which a Runner runs with Func = "[name]". This can be passed more than once.
+// A config run by a Call can use the same Funcs.
+func WithFunc(name string, f Func) Option {
+	return func(e *Executor) {
+		if e.funcs == nil {
+			e.funcs = map[string]Func{}
+		}
+		e.funcs[name] = f
+	}
+}
+
+// checkFuncs returns an error if a Runner in "seqs", their OnFailure or the configs their Calls run has a Func that
+// is not registered.
+func (e *Executor) checkFuncs(seqs []*config.Sequence) error {
+	for _, s := range seqs {
+		for _, n := range append([]*config.Sequence{s}, s.OnFailure()...) {
+			switch item := n.Item().(type) {
+			case *config.Runner:
+				if item.Func == "" {
+					continue
+				}
+				if _, ok := e.funcs[item.Func]; !ok {
+					return fmt.Errorf("Runner(%s) has Func(%s), which is not registered with the Executor", item.Name, item.Func)
+				}
+			case *config.Call:
+				for _, seqs := range [][]*config.Sequence{item.Child().Sequences(), item.Child().FinallySequences()} {
+					if err := e.checkFuncs(seqs); err != nil {
+						return fmt.Errorf("Call(%s): %w", item.Name, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// runFunc runs the Func of Runner "r" and returns its result as the output of a command.
+func (e *Executor) runFunc(ctx context.Context, r *config.Runner) (cmd.Output, error) {
+	f, ok := e.funcs[r.Func]
+	if !ok {
+		return cmd.Output{ExitCode: -1}, fmt.Errorf("Runner(%s) has Func(%s), which is not registered with the Executor", r.Name, r.Func)
+	}
+	vals := make(map[string]string, len(e.vals))
+	for k, v := range e.vals {
+		vals[k] = v
+	}
+
+	outputs, err := f(ctx, vals)
+	if err != nil {
+		return cmd.Output{Stderr: []byte(err.Error()), ExitCode: 1}, fmt.Errorf("Func(%s): %w", r.Func, err)
+	}
+	if outputs == nil {
+		outputs = map[string]string{}
+	}
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		return cmd.Output{ExitCode: 1}, fmt.Errorf("Func(%s): could not encode outputs: %w", r.Func, err)
+	}
+	return cmd.Output{Stdout: b}, nil
+}
+
+// outputs stores the outputs of the Func of Runner "r", which are in "out", at the keys in its Outputs.
+func (e *Executor) outputs(r *config.Runner, out cmd.Output) error {
+	if len(r.Outputs) == 0 {
+		return nil
+	}
+	outputs := map[string]string{}
+	if err := json.Unmarshal(out.Stdout, &outputs); err != nil {
+		return fmt.Errorf("Runner(%s): Func outputs are not a JSON object of strings: %w", r.Name, err)
+	}
+	for k, name := range r.Outputs {
+		v, ok := outputs[name]
+		if !ok {
+			return fmt.Errorf("Runner(%s): output(%s) was not set by Func(%s)", r.Name, name, r.Func)
+		}
+		e.vals[k] = v
+	}
+	return nil
+}
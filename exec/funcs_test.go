@@ -0,0 +1,226 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestCheckFuncs(t *testing.T) {
+	const child = `
+[[Seqs]]
+	Name = "Test"
+	Cmd = "true"
+`
+
+	tests := []struct {
+		desc    string
+		files   map[string]string
+		wantErr bool
+	}{
+		{
+			desc: "Registered in a Call",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+`,
+				"child.toml": child + `
+[[Seqs]]
+	Name = "Validate"
+	Func = "validate"
+`,
+			},
+		},
+		{
+			desc: "Missing",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "Validate"
+	Func = "missing"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Missing in a Call",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+`,
+				"child.toml": child + `
+[[Seqs]]
+	Name = "Validate"
+	Func = "missing"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Missing in the OnFailure of a Call",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+`,
+				"child.toml": `
+[[Seqs]]
+	Name = "Test"
+	Cmd = "true"
+	[[Seqs.OnFailure]]
+		Name = "Logs"
+		Func = "missing"
+`,
+			},
+			wantErr: true,
+		},
+		{
+			desc: "Missing in the Finally of a nested Call",
+			files: map[string]string{
+				"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+`,
+				"child.toml": child + `
+[[Seqs]]
+	Name = "Grandchild"
+	Config = "grandchild.toml"
+`,
+				"grandchild.toml": child + `
+[[Finally]]
+	Name = "Cleanup"
+	Func = "missing"
+`,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		validate := func(ctx context.Context, vals map[string]string) (map[string]string, error) {
+			return nil, nil
+		}
+		e, err := testRun(t, test.files, WithFunc("validate", validate))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestCheckFuncs(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestCheckFuncs(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			// No step, not even the ones before the Call, can have run.
+			if len(e.Outcomes()) != 0 {
+				t.Errorf("TestCheckFuncs(%s): got outcomes %v, want none", test.desc, statuses(e))
+			}
+		}
+	}
+}
+
+func TestFuncOutputs(t *testing.T) {
+	const content = `
+[[Seqs]]
+	Name = "Validate"
+	Func = "validate"
+	Retries = 2
+	RetrySleep = "1ms"
+	ValueKey = "Result"
+	[Seqs.RetryOn]
+		Stderr = "throttled"
+	[Seqs.Outputs]
+		State = "state"
+`
+
+	tests := []struct {
+		desc      string
+		errs      []error
+		outputs   map[string]string
+		wantErr   bool
+		wantCalls int
+		wantVals  map[string]string
+	}{
+		{
+			desc:      "Outputs",
+			outputs:   map[string]string{"state": "ok", "other": "ignored"},
+			wantCalls: 1,
+			wantVals:  map[string]string{"State": "ok", "Result": `{"other":"ignored","state":"ok"}`},
+		},
+		{
+			desc:      "Missing output",
+			outputs:   map[string]string{"other": "ignored"},
+			wantErr:   true,
+			wantCalls: 1,
+			wantVals:  map[string]string{"Result": `{"other":"ignored"}`},
+		},
+		{
+			desc:      "Retried on stderr",
+			errs:      []error{errors.New("throttled"), errors.New("throttled")},
+			outputs:   map[string]string{"state": "ok"},
+			wantCalls: 3,
+			wantVals:  map[string]string{"State": "ok", "Result": `{"state":"ok"}`},
+		},
+		{
+			desc:      "Not retried on stderr",
+			errs:      []error{errors.New("denied")},
+			outputs:   map[string]string{"state": "ok"},
+			wantErr:   true,
+			wantCalls: 1,
+			wantVals:  map[string]string{"Result": ""},
+		},
+	}
+
+	for _, test := range tests {
+		calls := 0
+		validate := func(ctx context.Context, vals map[string]string) (map[string]string, error) {
+			calls++
+			if calls <= len(test.errs) {
+				return nil, test.errs[calls-1]
+			}
+			return test.outputs, nil
+		}
+
+		e, err := testRun(t, map[string]string{"config.toml": content}, WithFunc("validate", validate))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestFuncOutputs(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestFuncOutputs(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if calls != test.wantCalls {
+			t.Errorf("TestFuncOutputs(%s): got %d calls, want %d", test.desc, calls, test.wantCalls)
+		}
+		got := map[string]string{}
+		for _, k := range []string{"State", "Result"} {
+			if v, ok := e.vals[k]; ok {
+				got[k] = v
+			}
+		}
+		if diff := pretty.Compare(test.wantVals, got); diff != "" {
+			t.Errorf("TestFuncOutputs(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/element-of-surprise/runme/internal/cmd"
+)
+
+// ErrSkipStep is returned by a BeforeStep to skip the step, which is recorded as Skipped.
+var ErrSkipStep = errors.New("skip step")
+
+// Result is the result of a step, given by a BeforeStep instead of running the step.
+type Result struct {
+	// Stdout, Stderr and ExitCode are stored in the ValueKey, StderrKey and ExitCodeKey of a Runner, as if its
+	// command output them. For a Runner with a Func, Stdout is a JSON object of its outputs. They are not used for
+	// other steps.
+	Stdout, Stderr string
+	ExitCode       int
+	// Err is the error the step fails with, nil if it succeeds.
+	Err error
+}
+
+// BeforeStep is called before each step is run, including steps in OnFailure and Finally. It is given the name
+// of the step and the vals, which it can change. A step in a called config is named "[Call name]/[step name]" and
+// is given the vals of the called config.
+//
+// Returning nil, nil runs the step. Returning a *Result uses it as the result of the step instead of running it,
+// such as for a test double. Returning ErrSkipStep skips the step and any other error fails it.
+type BeforeStep func(name string, vals map[string]string) (*Result, error)
+
+// AfterStep is called after each step is run, or given a Result by a BeforeStep. It is given the name of the step,
+// the vals, which it can change, and the error the step failed with. The error it returns replaces that error, so
+// returning nil makes a failed step succeed.
+type AfterStep func(name string, vals map[string]string, err error) error
+
+// WithBeforeStep sets a BeforeStep hook.
+func WithBeforeStep(h BeforeStep) Option {
+	return func(e *Executor) {
+		e.beforeStep = h
+	}
+}
+
+// WithAfterStep sets an AfterStep hook.
+func WithAfterStep(h AfterStep) Option {
+	return func(e *Executor) {
+		e.afterStep = h
+	}
+}
+
+// before calls our BeforeStep for the step "name", if we have one.
+func (e *Executor) before(name string) (*Result, error) {
+	if e.beforeStep == nil {
+		return nil, nil
+	}
+	res, err := e.beforeStep(name, e.vals)
+	switch {
+	case errors.Is(err, ErrSkipStep):
+		return nil, err
+	case err != nil:
+		return nil, fmt.Errorf("BeforeStep(%s): %w", name, err)
+	}
+	return res, nil
+}
+
+// after calls our AfterStep for the step "name", which failed with "err", if we have one.
+func (e *Executor) after(name string, err error) error {
+	if e.afterStep == nil {
+		return err
+	}
+	return e.afterStep(name, e.vals, err)
+}
+
+// inject uses "res" from our BeforeStep as the result of "node" instead of running it.
+func (e *Executor) inject(node *config.Sequence, name string, res *Result) error {
+	fmt.Printf("Executing(BeforeStep): %s: using the result from BeforeStep\n", name)
+	r, ok := node.Item().(*config.Runner)
+	if !ok {
+		return res.Err
+	}
+	out := cmd.Output{Stdout: []byte(res.Stdout), Stderr: []byte(res.Stderr), ExitCode: res.ExitCode}
+	e.store(r, out)
+	if res.Err != nil {
+		return res.Err
+	}
+	return e.outputs(r, out)
+}
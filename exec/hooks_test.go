@@ -0,0 +1,195 @@
+package exec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestHooks(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "false"
+	ValueKey = "Out"
+	ExitCodeKey = "Code"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+`,
+		"child.toml": `
+[[Seqs]]
+	Name = "Test"
+	Cmd = "true"
+`,
+	}
+
+	tests := []struct {
+		desc         string
+		before       BeforeStep
+		after        AfterStep
+		wantErr      bool
+		wantVals     map[string]string
+		wantStatuses []string
+	}{
+		{
+			desc:         "No hooks",
+			wantErr:      true,
+			wantVals:     map[string]string{"Out": "", "Code": "1"},
+			wantStatuses: []string{"Seqs: Build: Failed"},
+		},
+		{
+			desc: "BeforeStep skips",
+			before: func(name string, vals map[string]string) (*Result, error) {
+				if name == "Build" {
+					return nil, ErrSkipStep
+				}
+				return nil, nil
+			},
+			wantStatuses: []string{"Seqs: Build: Skipped", "Seqs: Child/Test: Succeeded", "Seqs: Child: Succeeded"},
+		},
+		{
+			desc: "BeforeStep injects a Result",
+			before: func(name string, vals map[string]string) (*Result, error) {
+				if name == "Build" {
+					return &Result{Stdout: "injected\n", ExitCode: 0}, nil
+				}
+				return nil, nil
+			},
+			wantVals:     map[string]string{"Out": "injected", "Code": "0"},
+			wantStatuses: []string{"Seqs: Build: Succeeded", "Seqs: Child/Test: Succeeded", "Seqs: Child: Succeeded"},
+		},
+		{
+			desc: "BeforeStep injects a failure",
+			before: func(name string, vals map[string]string) (*Result, error) {
+				return &Result{Stderr: "broken", ExitCode: 2, Err: errors.New("broken")}, nil
+			},
+			wantErr:      true,
+			wantVals:     map[string]string{"Out": "", "Code": "2"},
+			wantStatuses: []string{"Seqs: Build: Failed"},
+		},
+		{
+			desc: "BeforeStep fails the step",
+			before: func(name string, vals map[string]string) (*Result, error) {
+				return nil, errors.New("no credentials")
+			},
+			wantErr:      true,
+			wantStatuses: []string{"Seqs: Build: Failed"},
+		},
+		{
+			desc: "AfterStep drops the error",
+			after: func(name string, vals map[string]string, err error) error {
+				return nil
+			},
+			wantVals:     map[string]string{"Out": "", "Code": "1"},
+			wantStatuses: []string{"Seqs: Build: Succeeded", "Seqs: Child/Test: Succeeded", "Seqs: Child: Succeeded"},
+		},
+		{
+			desc: "AfterStep fails a step in a Call",
+			before: func(name string, vals map[string]string) (*Result, error) {
+				if name == "Build" {
+					return &Result{}, nil
+				}
+				return nil, nil
+			},
+			after: func(name string, vals map[string]string, err error) error {
+				if name == "Child/Test" {
+					return errors.New("tests were flaky")
+				}
+				return err
+			},
+			wantErr:      true,
+			wantStatuses: []string{"Seqs: Build: Succeeded", "Seqs: Child/Test: Failed", "Seqs: Child: Failed"},
+		},
+	}
+
+	for _, test := range tests {
+		var opts []Option
+		if test.before != nil {
+			opts = append(opts, WithBeforeStep(test.before))
+		}
+		if test.after != nil {
+			opts = append(opts, WithAfterStep(test.after))
+		}
+
+		e, err := testRun(t, files, opts...)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestHooks(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestHooks(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		for k, want := range test.wantVals {
+			if got := e.vals[k]; got != want {
+				t.Errorf("TestHooks(%s): got val(%s) == %q, want %q", test.desc, k, got, want)
+			}
+		}
+		if diff := pretty.Compare(test.wantStatuses, statuses(e)); diff != "" {
+			t.Errorf("TestHooks(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestHookNames(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "true"
+	[[Seqs.OnFailure]]
+		Name = "Logs"
+		Cmd = "true"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+
+[[Finally]]
+	Name = "Cleanup"
+	Cmd = "true"
+`,
+		"child.toml": `
+[[Seqs]]
+	Name = "Test"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "Grandchild"
+	Config = "grandchild.toml"
+`,
+		"grandchild.toml": `
+[[Seqs]]
+	Name = "Lint"
+	Cmd = "true"
+`,
+	}
+
+	before, after := []string{}, []string{}
+	_, err := testRun(
+		t,
+		files,
+		WithBeforeStep(func(name string, vals map[string]string) (*Result, error) {
+			before = append(before, name)
+			return nil, nil
+		}),
+		WithAfterStep(func(name string, vals map[string]string, err error) error {
+			after = append(after, name)
+			return err
+		}),
+	)
+	if err != nil {
+		t.Fatalf("TestHookNames: got err == %s, want err == nil", err)
+	}
+
+	want := []string{"Build", "Child", "Child/Test", "Child/Grandchild", "Child/Grandchild/Lint", "Cleanup"}
+	if diff := pretty.Compare(want, before); diff != "" {
+		t.Errorf("TestHookNames: BeforeStep: -want/+got:\n%s", diff)
+	}
+	want = []string{"Build", "Child/Test", "Child/Grandchild/Lint", "Child/Grandchild", "Child", "Cleanup"}
+	if diff := pretty.Compare(want, after); diff != "" {
+		t.Errorf("TestHookNames: AfterStep: -want/+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,48 @@
+package exec
+
+// Option is an option for New.
+type Option func(e *Executor)
+
+// Approver is called to approve the Approve step "name", which has the summary "summary". It returns true if the
+// step is approved. If it cannot ask anyone, it should return ErrNeedsApproval.
+type Approver func(name, summary string) (bool, error)
+
+// WithApprover sets the Approver for Approve steps. Without one, every Approve step stops the run with
+// ErrNeedsApproval.
+func WithApprover(a Approver) Option {
+	return func(e *Executor) {
+		e.approver = a
+	}
+}
+
+// childOptions returns the options for the Executor of a config run by the Call "call". Our Approver, Stepper and
+// hooks are given the names of steps in the called config as "[Call name]/[step name]". Our Selection is not passed on.
+func (e *Executor) childOptions(call string) []Option {
+	opts := append([]Option{}, e.opts...)
+	opts = append(opts, WithSelection(Selection{}))
+	if e.approver != nil {
+		opts = append(opts, WithApprover(func(name, summary string) (bool, error) {
+			return e.approver(call+"/"+name, summary)
+		}))
+	}
+	if e.stepper != nil {
+		opts = append(opts, WithStepper(func(s *Step) (Action, error) {
+			name := s.Name
+			s.Name = call + "/" + name
+			a, err := e.stepper(s)
+			s.Name = name
+			return a, err
+		}))
+	}
+	if e.beforeStep != nil {
+		opts = append(opts, WithBeforeStep(func(name string, vals map[string]string) (*Result, error) {
+			return e.beforeStep(call+"/"+name, vals)
+		}))
+	}
+	if e.afterStep != nil {
+		opts = append(opts, WithAfterStep(func(name string, vals map[string]string, err error) error {
+			return e.afterStep(call+"/"+name, vals, err)
+		}))
+	}
+	return opts
+}
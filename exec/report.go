@@ -0,0 +1,90 @@
+package exec
+
+import (
+	"errors"
+
+	"github.com/element-of-surprise/runme/config"
+)
+
+// Stage is when a step was run.
+type Stage string
+
+const (
+	// InSeqs is a step in Seqs.
+	InSeqs Stage = "Seqs"
+	// InOnFailure is a step in the OnFailure of a step that failed.
+	InOnFailure Stage = "OnFailure"
+	// InFinally is a step in Finally.
+	InFinally Stage = "Finally"
+)
+
+// Status is the status of a step that was run. Templates can use it as {{ .Steps.Name.Status }}.
+type Status string
+
+const (
+	// Succeeded is a step that succeeded.
+	Succeeded Status = "Succeeded"
+	// Failed is a step that failed.
+	Failed Status = "Failed"
+	// Tolerated is a step with ContinueOnError that failed, so the run continued.
+	Tolerated Status = "Tolerated"
+	// Skipped is a step whose When was false.
+	Skipped Status = "Skipped"
+	// Paused is a step that stopped the run so that it can be resumed at the step, because it needs approval or
+	// a Stepper quit.
+	Paused Status = "Paused"
+)
+
+// Outcome is the outcome of a step that was run.
+type Outcome struct {
+	// Name is the name of the step. A step run by a Call is named "[Call name]/[step name]".
+	Name string
+	// Stage is when the step was run.
+	Stage Stage
+	// Status is the status of the step.
+	Status Status
+	// Err is the error the step failed with, with secrets redacted. This is nil unless it is Failed, Tolerated or
+	// Paused.
+	Err error
+}
+
+// Outcomes returns the outcomes of all the steps that were run, in the order they were run.
+func (e *Executor) Outcomes() []Outcome {
+	return e.outcomes
+}
+
+// Tolerated returns the outcomes of the steps that failed with ContinueOnError set.
+func (e *Executor) Tolerated() []Outcome {
+	tolerated := []Outcome{}
+	for _, o := range e.outcomes {
+		if o.Status == Tolerated {
+			tolerated = append(tolerated, o)
+		}
+	}
+	return tolerated
+}
+
+// record records the outcome of the step "name". Secrets in "err" are redacted. Unless the step is an Undo,
+// its status is stored in our vals so that later templates can use it.
+func (e *Executor) record(name string, stage Stage, status Status, err error) {
+	e.outcomes = append(e.outcomes, Outcome{Name: name, Stage: stage, Status: status, Err: e.redactErr(err)})
+	if stage != InUndo {
+		e.vals[config.StatusKey(name)] = string(status)
+	}
+}
+
+// paused returns true if "err" stopped the run so that it can be resumed, instead of failing it.
+func paused(err error) bool {
+	return errors.Is(err, ErrNeedsApproval) || errors.Is(err, ErrQuit)
+}
+
+// status returns the Status of a step that returned "err" and has "continueOnError" set.
+func status(err error, continueOnError bool) Status {
+	switch {
+	case err == nil:
+		return Succeeded
+	case continueOnError:
+		return Tolerated
+	}
+	return Failed
+}
@@ -0,0 +1,105 @@
+package exec
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestOnFailureAndFinally(t *testing.T) {
+	config := func(test string) map[string]string {
+		return map[string]string{"config.toml": `
+[[Seqs]]
+	Name = "Build"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "Test"
+	Shell = "sh"
+	Cmd = "echo partial; ` + test + `"
+	ValueKey = "Partial"
+	[[Seqs.OnFailure]]
+		Name = "Logs"
+		Cmd = "echo got {{ .Partial }}"
+		ValueKey = "Logs"
+	[[Seqs.OnFailure]]
+		Name = "BrokenLogs"
+		Cmd = "false"
+	[[Seqs.OnFailure]]
+		Name = "Dump"
+		Cmd = "true"
+
+[[Seqs]]
+	Name = "Deploy"
+	Cmd = "true"
+
+[[Finally]]
+	Name = "Cleanup"
+	Cmd = "false"
+
+[[Finally]]
+	Name = "Logout"
+	Cmd = "true"
+`}
+	}
+
+	tests := []struct {
+		desc         string
+		test         string
+		wantErr      bool
+		wantLogs     string
+		wantStatuses []string
+	}{
+		{
+			desc: "Success runs Finally",
+			test: "true",
+			wantStatuses: []string{
+				"Seqs: Build: Succeeded",
+				"Seqs: Test: Succeeded",
+				"Seqs: Deploy: Succeeded",
+				"Finally: Cleanup: Failed",
+				"Finally: Logout: Succeeded",
+			},
+		},
+		{
+			desc:     "Failure runs OnFailure then Finally",
+			test:     "exit 1",
+			wantErr:  true,
+			wantLogs: "got partial",
+			wantStatuses: []string{
+				"Seqs: Build: Succeeded",
+				"Seqs: Test: Failed",
+				"OnFailure: Logs: Succeeded",
+				"OnFailure: BrokenLogs: Failed",
+				"OnFailure: Dump: Succeeded",
+				"Finally: Cleanup: Failed",
+				"Finally: Logout: Succeeded",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		e, err := testRun(t, config(test.test))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestOnFailureAndFinally(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			// A failure in Finally is only a warning.
+			t.Errorf("TestOnFailureAndFinally(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if test.wantErr && e.FailedNode() != "Test" {
+			t.Errorf("TestOnFailureAndFinally(%s): got FailedNode %q, want %q", test.desc, e.FailedNode(), "Test")
+		}
+		if e.vals["Logs"] != test.wantLogs {
+			t.Errorf("TestOnFailureAndFinally(%s): got Logs %q, want %q", test.desc, e.vals["Logs"], test.wantLogs)
+		}
+		if diff := pretty.Compare(test.wantStatuses, statuses(e)); diff != "" {
+			t.Errorf("TestOnFailureAndFinally(%s): -want/+got:\n%s", test.desc, diff)
+		}
+		for _, o := range e.Outcomes() {
+			if (o.Status == Failed) != (o.Err != nil) {
+				t.Errorf("TestOnFailureAndFinally(%s): step(%s) is %s with Err == %v", test.desc, o.Name, o.Status, o.Err)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/element-of-surprise/runme/internal/cmd"
+)
+
+// attempt runs the Cmd "c" for Runner "r" once, or its Func, until "ctx" is done. An exit code in AllowedExitCodes
+// is not an error.
+func (e *Executor) attempt(ctx context.Context, r *config.Runner, c *cmd.Cmd) (cmd.Output, error) {
+	out, err := e.runCmd(ctx, r, c)
+	if err != nil && allowed(r.AllowedExitCodes, out.ExitCode) {
+		fmt.Printf("cmd returned allowed exit code: %d\n", out.ExitCode)
+		err = nil
+	}
+	if err == nil {
+		err = e.checkOutput(r, out)
+	}
+	if err == nil {
+		err = e.expect(r, out)
+	}
+	return out, err
+}
+
+// expect runs the Expect checks of Runner "r" on "out". A failed check returns an error that wraps a
+// *config.ExpectError.
+func (e *Executor) expect(r *config.Runner, out cmd.Output) error {
+	for _, x := range r.Expect {
+		if err := x.Check(out.Stdout, e.render); err != nil {
+			expectErr := &config.ExpectError{}
+			if errors.As(err, &expectErr) {
+				// Msg can have the rendered values of Equals, Contains and In.
+				expectErr.Msg = e.redact(expectErr.Msg)
+				expectErr.Value = e.redact(expectErr.Value)
+				if len(expectErr.Value) > maxValueDetail {
+					expectErr.Value = expectErr.Value[:maxValueDetail] + "..."
+				}
+			}
+			return fmt.Errorf("Runner(%s): %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// retry runs the Cmd "c" for Runner "r" until it succeeds or runs out of Retries. Each failed attempt
+// and why it is or isn't retried is printed.
+func (e *Executor) retry(r *config.Runner, c *cmd.Cmd) (cmd.Output, error) {
+	var out cmd.Output
+	var err error
+	for i := 0; i < r.Retries+1; i++ {
+		if i > 0 {
+			c, _, err = e.runnerCmd(r)
+			if err != nil {
+				return out, err
+			}
+		}
+		out, err = e.attempt(context.Background(), r, c)
+		if err == nil {
+			return out, nil
+		}
+		fmt.Println("cmd returned error: ", e.redact(err.Error()))
+
+		retry, reason := retryReason(r, out, err)
+		if !retry {
+			fmt.Printf("Attempt(%d) of Runner(%s) failed with %s, not retrying\n", i+1, r.Name, reason)
+			break
+		}
+		if i == r.Retries {
+			if r.Retries > 0 {
+				fmt.Printf("Attempt(%d) of Runner(%s) failed with %s, no retries left\n", i+1, r.Name, reason)
+			}
+			break
+		}
+		sleep := retrySleep(r, i+1)
+		fmt.Printf("Attempt(%d) of Runner(%s) failed with %s, retrying in %v\n", i+1, r.Name, reason, sleep.Round(time.Millisecond))
+		time.Sleep(sleep)
+	}
+	return out, err
+}
+
+// retryReason returns if Runner "r" should be retried after a failed attempt with output "out" and error "err", and why.
+func retryReason(r *config.Runner, out cmd.Output, err error) (bool, string) {
+	var expectErr *config.ExpectError
+	errors.As(err, &expectErr)
+
+	if r.NoRetryOn != nil {
+		if m := r.NoRetryOn.Match(out.ExitCode, out.Stdout, out.Stderr, expectErr); m != "" {
+			return false, m + " matching NoRetryOn"
+		}
+	}
+	why := fmt.Sprintf("exit code(%d)", out.ExitCode)
+	if expectErr != nil {
+		why = fmt.Sprintf("Expect(%s)", expectErr.Msg)
+	}
+	if r.RetryOn != nil {
+		if m := r.RetryOn.Match(out.ExitCode, out.Stdout, out.Stderr, expectErr); m != "" {
+			return true, m + " matching RetryOn"
+		}
+		return false, why + " not matching RetryOn"
+	}
+	return true, why
+}
+
+// retrySleep returns how long to sleep before retry number "retry" of Runner "r", with Jitter added.
+func retrySleep(r *config.Runner, retry int) time.Duration {
+	d := r.RetrySleepFor(retry)
+	if r.Jitter > 0 {
+		d += time.Duration(rand.Float64() * r.Jitter * float64(d))
+	}
+	return d
+}
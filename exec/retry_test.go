@@ -0,0 +1,115 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		desc string
+		// until is the attempt that succeeds, earlier attempts exit with code 7 and write "stderr".
+		until        int
+		stderr       string
+		opts         string
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			desc:         "Retried until it succeeds",
+			until:        3,
+			stderr:       "broken",
+			opts:         "Retries = 3",
+			wantAttempts: 3,
+		},
+		{
+			desc:         "Out of retries",
+			until:        5,
+			stderr:       "broken",
+			opts:         "Retries = 1",
+			wantErr:      true,
+			wantAttempts: 2,
+		},
+		{
+			desc:   "RetryOn Stderr matches",
+			until:  3,
+			stderr: "throttled",
+			opts: `Retries = 3
+	[Seqs.RetryOn]
+		Stderr = "throttled|429"`,
+			wantAttempts: 3,
+		},
+		{
+			desc:   "RetryOn ExitCodes does not match",
+			until:  3,
+			stderr: "broken",
+			opts: `Retries = 3
+	[Seqs.RetryOn]
+		ExitCodes = [9]`,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			desc:   "NoRetryOn wins over RetryOn",
+			until:  3,
+			stderr: "denied",
+			opts: `Retries = 3
+	[Seqs.RetryOn]
+		ExitCodes = [7]
+	[Seqs.NoRetryOn]
+		Stderr = "denied"`,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			desc:  "RetryOn Expect",
+			until: 1,
+			opts: `Retries = 3
+	[Seqs.RetryOn]
+		Expect = true
+	[[Seqs.Expect]]
+		Equals = "2"`,
+			wantAttempts: 2,
+		},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		content := fmt.Sprintf(`
+[[Required]]
+	Name = "Dir"
+	Default = %q
+
+[[Seqs]]
+	Name = "Flaky"
+	Shell = "sh"
+	Cmd = '''
+echo x >> {{ .Dir }}/count
+n=$(wc -l < {{ .Dir }}/count)
+echo $n
+[ $n -ge %d ] || { echo %s >&2; exit 7; }
+'''
+	RetrySleep = "1ms"
+	%s
+`, dir, test.until, test.stderr, test.opts)
+
+		_, err := testRun(t, map[string]string{"config.toml": content})
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestRetry(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestRetry(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, "count"))
+		if err != nil {
+			t.Errorf("TestRetry(%s): could not read the attempts: %s", test.desc, err)
+			continue
+		}
+		if got := strings.Count(string(b), "\n"); got != test.wantAttempts {
+			t.Errorf("TestRetry(%s): got %d attempts, want %d", test.desc, got, test.wantAttempts)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package exec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/element-of-surprise/runme/config"
+)
+
+// InUndo is a step's Undo run by Rollback.
+const InUndo Stage = "Undo"
+
+// Completed is a step in Seqs that completed and has an Undo, which can be run by Rollback.
+type Completed struct {
+	// Name is the name of the step. A step run by a Call is named "[Call name]/[step name]".
+	Name string
+	// Vals are the vals after the step completed, which its Undo is run with.
+	Vals map[string]string
+}
+
+// Completed returns the steps with an Undo that completed, in the order they were run.
+func (e *Executor) Completed() []Completed {
+	return e.completed
+}
+
+// complete records that Runner "r" completed, if it has an Undo.
+func (e *Executor) complete(r *config.Runner) {
+	if r.Undo == "" {
+		return
+	}
+	vals := make(map[string]string, len(e.vals))
+	for k, v := range e.vals {
+		vals[k] = v
+	}
+	e.completed = append(e.completed, Completed{Name: r.Name, Vals: vals})
+}
+
+// Rollback runs the Undo of each of "completed" in reverse order, using the vals of each. The steps are found
+// in "c". If an Undo fails, the rest are still run. This returns the steps that were not undone, which should
+// be given to Rollback again once the problem is fixed.
+func (e *Executor) Rollback(c *config.Config, completed []Completed) ([]Completed, error) {
+	e.conf = c
+
+	remaining := []Completed{}
+	failed := 0
+	for i := len(completed) - 1; i >= 0; i-- {
+		step := completed[i]
+		err := e.undo(c, step)
+		e.record(step.Name, InUndo, status(err, false), err)
+		if err != nil {
+			e.warnf(step.Name, "Undo failed: %s", err)
+			// We keep the order they were run in.
+			remaining = append([]Completed{step}, remaining...)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return remaining, fmt.Errorf("%d of %d steps could not be undone", failed, len(completed))
+	}
+	return remaining, nil
+}
+
+// undo runs the Undo of the step "step", which is found in "c". The Undo of a step in a called config is run
+// with that config's Env, InheritEnv and secrets.
+func (e *Executor) undo(c *config.Config, step Completed) error {
+	r, owner := findRunner(c, step.Name)
+	if r == nil {
+		return fmt.Errorf("Runner(%s) could not be found in the config", step.Name)
+	}
+	if r.Undo == "" {
+		return fmt.Errorf("Runner(%s) no longer has an Undo", step.Name)
+	}
+
+	conf := e.conf
+	e.conf = owner
+	defer func() { e.conf = conf }()
+
+	// The Undo is run like the Runner's Cmd, so it has the Runner's Shell, WorkDir and Env.
+	u := &config.Runner{
+		Name:       r.Name,
+		Cmd:        r.Undo,
+		Shell:      r.Shell,
+		WorkDir:    r.WorkDir,
+		Env:        r.Env,
+		InheritEnv: r.InheritEnv,
+	}
+	e.vals = step.Vals
+	uc, details, err := e.runnerCmd(u)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Executing(Undo): %s: %s\n", r.Name, e.redact(uc.String()))
+	for _, d := range details {
+		fmt.Printf("\t%s\n", d)
+	}
+	_, err = uc.Run()
+	// Our error is redacted with the secrets of "owner" before they are put back.
+	return e.redactErr(err)
+}
+
+// findRunner returns the Runner named "name" in the Seqs of "c" and the config it is in, which is "c" or a
+// config run by a Call, or nil if there isn't one. A Runner in a config run by a Call is named
+// "[Call name]/[Runner name]".
+func findRunner(c *config.Config, name string) (*config.Runner, *config.Config) {
+	for _, s := range c.Sequences() {
+		if r, ok := s.Item().(*config.Runner); ok && r.Name == name {
+			return r, c
+		}
+	}
+	for _, s := range c.Sequences() {
+		if call, ok := s.Item().(*config.Call); ok && strings.HasPrefix(name, call.Name+"/") {
+			if r, owner := findRunner(call.Child(), strings.TrimPrefix(name, call.Name+"/")); r != nil {
+				return r, owner
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,159 @@
+package exec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/gopherfs/fs/io/mem/simple"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+// rollbackFiles returns a config whose steps log to "dir"/log. The Undo of Create is "createUndo".
+func rollbackFiles(dir, createUndo string) map[string]string {
+	return map[string]string{
+		"config.toml": fmt.Sprintf(`
+[[Required]]
+	Name = "Dir"
+	Default = %q
+
+[[Seqs]]
+	Name = "Create"
+	Shell = "sh"
+	Cmd = "echo create >> {{ .Dir }}/log"
+	Undo = %q
+
+[[Seqs]]
+	Name = "Group"
+	Cmd = "echo rg"
+	ValueKey = "Group"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+	[Seqs.Vals]
+		Dir = "{{ .Dir }}"
+		Group = "{{ .Group }}"
+
+[[Seqs]]
+	Name = "Fail"
+	Cmd = "false"
+	Undo = "echo never"
+
+[[Seqs]]
+	Name = "Last"
+	Cmd = "true"
+	Undo = "echo never"
+`, dir, createUndo),
+		"child.toml": `
+[[Required]]
+	Name = "Dir"
+
+[[Required]]
+	Name = "Group"
+
+[[Seqs]]
+	Name = "Network"
+	Shell = "sh"
+	Cmd = "true"
+	Undo = "echo undo network {{ .Group }} >> {{ .Dir }}/log"
+`,
+	}
+}
+
+func TestRollback(t *testing.T) {
+	dir := t.TempDir()
+	files := rollbackFiles(dir, "echo undo create >> {{ .Dir }}/log")
+
+	e, err := testRun(t, files)
+	if err == nil {
+		t.Fatalf("TestRollback: got err == nil, want err != nil")
+	}
+
+	// Fail never completed and Last never ran, so only Create and Child/Network can be undone.
+	completed := e.Completed()
+	names := []string{}
+	for _, c := range completed {
+		names = append(names, c.Name)
+	}
+	if diff := pretty.Compare([]string{"Create", "Child/Network"}, names); diff != "" {
+		t.Fatalf("TestRollback: Completed: -want/+got:\n%s", diff)
+	}
+	// The vals are as they were when each step completed.
+	if _, ok := completed[0].Vals["Group"]; ok {
+		t.Errorf("TestRollback: Create has Group in its vals, which was set after it completed")
+	}
+	if completed[1].Vals["Group"] != "rg" {
+		t.Errorf("TestRollback: Child/Network got Group == %q, want %q", completed[1].Vals["Group"], "rg")
+	}
+
+	_, remaining, err := rollback(t, files, completed)
+	if err != nil {
+		t.Fatalf("TestRollback: Rollback() got err == %s, want err == nil", err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("TestRollback: got %d remaining, want 0", len(remaining))
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "log"))
+	if err != nil {
+		t.Fatalf("TestRollback: could not read the log: %s", err)
+	}
+	want := []string{"create", "undo network rg", "undo create"}
+	if diff := pretty.Compare(want, strings.Split(strings.TrimSpace(string(b)), "\n")); diff != "" {
+		t.Errorf("TestRollback: log: -want/+got:\n%s", diff)
+	}
+}
+
+func TestRollbackFailure(t *testing.T) {
+	dir := t.TempDir()
+	files := rollbackFiles(dir, "false")
+
+	completed := []Completed{
+		{Name: "Create", Vals: map[string]string{"Dir": dir}},
+		{Name: "Gone", Vals: map[string]string{"Dir": dir}},
+		{Name: "Child/Network", Vals: map[string]string{"Dir": dir, "Group": "rg"}},
+	}
+	e, remaining, err := rollback(t, files, completed)
+	if err == nil {
+		t.Fatalf("TestRollbackFailure: got err == nil, want err != nil")
+	}
+
+	// The Undo after the failures still ran and the steps that were not undone are kept in the order they ran.
+	names := []string{}
+	for _, c := range remaining {
+		names = append(names, c.Name)
+	}
+	if diff := pretty.Compare([]string{"Create", "Gone"}, names); diff != "" {
+		t.Errorf("TestRollbackFailure: remaining: -want/+got:\n%s", diff)
+	}
+	want := []string{"Undo: Child/Network: Succeeded", "Undo: Gone: Failed", "Undo: Create: Failed"}
+	if diff := pretty.Compare(want, statuses(e)); diff != "" {
+		t.Errorf("TestRollbackFailure: -want/+got:\n%s", diff)
+	}
+}
+
+// rollback reads the config in "files" and runs Rollback with "completed". It returns the Executor and what Rollback
+// returned.
+func rollback(t *testing.T, files map[string]string, completed []Completed) (*Executor, []Completed, error) {
+	t.Helper()
+
+	wfs := simple.New()
+	for p, content := range files {
+		if err := wfs.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatalf("could not write file(%s): %s", p, err)
+		}
+	}
+	c, err := config.FromFile(wfs, "config.toml", map[string]string{})
+	if err != nil {
+		t.Fatalf("could not read the config: %s", err)
+	}
+	e, err := New(c.Sequences(), "", wfs, map[string]string{})
+	if err != nil {
+		t.Fatalf("could not create the Executor: %s", err)
+	}
+	remaining, err := e.Rollback(c, completed)
+	return e, remaining, err
+}
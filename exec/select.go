@@ -0,0 +1,172 @@
+package exec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/element-of-surprise/runme/config"
+)
+
+// Selection chooses which steps in Seqs are run. Each name is the Name of a step or one of its Tags. The name of a
+// Macro entry also matches all the steps of the Macro, which are named "[Macro entry name]/[step name]". A Call is
+// run or skipped as a whole. Steps that are not selected are recorded as Skipped.
+type Selection struct {
+	// Only, if set, runs only the steps that match one of these.
+	Only []string `json:",omitempty"`
+	// Skip skips the steps that match one of these.
+	Skip []string `json:",omitempty"`
+	// From is the first step to run. If it is a tag, this is the first step with the tag.
+	From string `json:",omitempty"`
+	// Until is the last step to run. If it is a tag, this is the last step with the tag.
+	Until string `json:",omitempty"`
+}
+
+// WithSelection sets which steps in Seqs are run. It does not apply to the steps of a config run by a Call.
+func WithSelection(s Selection) Option {
+	return func(e *Executor) {
+		e.selection = s
+	}
+}
+
+// UndefinedError is returned by CheckSelection and Run when steps that are not selected set variables that selected
+// steps use.
+type UndefinedError struct {
+	// Keys maps each variable that is not set to the step that would have set it.
+	Keys map[string]string
+}
+
+func (u *UndefinedError) Error() string {
+	keys := make([]string, 0, len(u.Keys))
+	for k := range u.Keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, k := range keys {
+		keys[i] = fmt.Sprintf("%s(set by %s)", k, u.Keys[k])
+	}
+	return fmt.Sprintf("selected steps use variables that are set by steps that are not selected: %s", strings.Join(keys, ", "))
+}
+
+// CheckSelection returns an error if our Selection is not valid, or if it skips steps that set variables which
+// the selected steps use and which are not in our vals. The latter is an *UndefinedError, which is fixed by adding
+// the variables to the vals passed to New.
+func (e *Executor) CheckSelection() error {
+	startAt, _, err := e.start()
+	if err != nil {
+		return err
+	}
+	selected, err := e.selected()
+	if err != nil {
+		return err
+	}
+	return e.undefined(startAt, selected)
+}
+
+// selected returns whether each of our Seqs is selected by our Selection.
+func (e *Executor) selected() ([]bool, error) {
+	s := e.selection
+	for field, names := range map[string][]string{"Only": s.Only, "Skip": s.Skip} {
+		for _, n := range names {
+			if e.first(n) == -1 {
+				return nil, fmt.Errorf("%s(%s) does not match a step or tag", field, n)
+			}
+		}
+	}
+
+	from, until := 0, len(e.seqs)-1
+	if s.From != "" {
+		if from = e.first(s.From); from == -1 {
+			return nil, fmt.Errorf("From(%s) does not match a step or tag", s.From)
+		}
+	}
+	if s.Until != "" {
+		until = -1
+		for i, seq := range e.seqs {
+			if matches(seq, s.Until) {
+				until = i
+			}
+		}
+		if until == -1 {
+			return nil, fmt.Errorf("Until(%s) does not match a step or tag", s.Until)
+		}
+	}
+	if from > until {
+		return nil, fmt.Errorf("From(%s) comes after Until(%s)", s.From, s.Until)
+	}
+
+	selected := make([]bool, len(e.seqs))
+	for i, seq := range e.seqs {
+		selected[i] = i >= from && i <= until && (len(s.Only) == 0 || matchesAny(seq, s.Only)) && !matchesAny(seq, s.Skip)
+	}
+	return selected, nil
+}
+
+// undefined returns an *UndefinedError if the steps from "startAt" that are not "selected" set variables that the
+// selected steps after them use, and that are not already in our vals.
+func (e *Executor) undefined(startAt int, selected []bool) error {
+	defined := map[string]bool{}
+	for k := range e.vals {
+		defined[k] = true
+	}
+	// skipped maps the variables set by skipped steps to the first step that sets them.
+	skipped := map[string]string{}
+	undefined := map[string]string{}
+	for i := startAt; i < len(e.seqs); i++ {
+		seq := e.seqs[i]
+		if !selected[i] {
+			for _, k := range seq.Defines() {
+				if _, ok := skipped[k]; !ok && !defined[k] {
+					skipped[k] = seq.Item().(sequencer).Sequence()
+				}
+			}
+			continue
+		}
+		for _, k := range seq.Uses() {
+			if step, ok := skipped[k]; ok && !defined[k] {
+				undefined[k] = step
+			}
+		}
+		for _, k := range seq.Defines() {
+			defined[k] = true
+		}
+	}
+	if len(undefined) > 0 {
+		return &UndefinedError{Keys: undefined}
+	}
+	return nil
+}
+
+// first returns the index of the first of our Seqs that matches "name", or -1 if none do.
+func (e *Executor) first(name string) int {
+	for i, seq := range e.seqs {
+		if matches(seq, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// matches returns true if "seq" is named "name", is a step of the Macro entry "name" or has the tag "name".
+func matches(seq *config.Sequence, name string) bool {
+	n := seq.Item().(sequencer).Sequence()
+	if n == name || strings.HasPrefix(n, name+"/") {
+		return true
+	}
+	for _, t := range seq.Tags() {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAny returns true if "seq" matches any of "names".
+func matchesAny(seq *config.Sequence, names []string) bool {
+	for _, n := range names {
+		if matches(seq, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package exec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestSelectApprove(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `
+[[Seqs]]
+	Name = "Create"
+	Cmd = "true"
+
+[[Seqs]]
+	Name = "ApproveDelete"
+	Approve = "Delete the old cluster"
+	Tags = ["cleanup"]
+
+[[Seqs]]
+	Name = "Delete"
+	Cmd = "true"
+	Tags = ["cleanup"]
+`,
+	}
+
+	e, err := testRun(t, files, WithSelection(Selection{Only: []string{"cleanup"}}))
+	if !errors.Is(err, ErrNeedsApproval) {
+		t.Fatalf("TestSelectApprove: got err == %v, want %s", err, ErrNeedsApproval)
+	}
+	want := []string{"Seqs: Create: Skipped", "Seqs: ApproveDelete: Paused"}
+	if diff := pretty.Compare(want, statuses(e)); diff != "" {
+		t.Errorf("TestSelectApprove: -want/+got:\n%s", diff)
+	}
+}
@@ -0,0 +1,63 @@
+package exec
+
+import (
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestStdin(t *testing.T) {
+	files := map[string]string{
+		"input.txt": "from a file",
+		"config.toml": `
+[[Required]]
+	Name = "Name"
+	Default = "world"
+
+[[Seqs]]
+	Name = "Source"
+	Cmd = "echo from a key"
+	ValueKey = "Text"
+
+[[Seqs]]
+	Name = "Stdin"
+	Cmd = "cat"
+	Stdin = "hello {{ .Name }}"
+	ValueKey = "FromStdin"
+
+[[Seqs]]
+	Name = "Key"
+	Cmd = "cat"
+	StdinFrom = "Text"
+	ValueKey = "FromKey"
+
+[[Seqs]]
+	Name = "File"
+	Cmd = "cat"
+	StdinFrom = "input.txt"
+	ValueKey = "FromFile"
+`,
+	}
+
+	e, err := testRun(t, files)
+	if err != nil {
+		t.Fatalf("TestStdin: got err == %s, want err == nil", err)
+	}
+	want := map[string]string{"FromStdin": "hello world", "FromKey": "from a key", "FromFile": "from a file"}
+	got := map[string]string{}
+	for k := range want {
+		got[k] = e.vals[k]
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestStdin: -want/+got:\n%s", diff)
+	}
+
+	delete(files, "input.txt")
+	e, err = testRun(t, files)
+	if err == nil {
+		t.Fatalf("TestStdin(missing file): got err == nil, want err != nil")
+	}
+	if e.FailedNode() != "File" {
+		t.Errorf("TestStdin(missing file): got FailedNode %q, want %q", e.FailedNode(), "File")
+	}
+}
@@ -0,0 +1,115 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/element-of-surprise/runme/config"
+)
+
+// ErrQuit is returned by Run, wrapped, when a Stepper quit the run. FailedNode is the step it quit at, so a resumed
+// run starts at it. The step is Paused and Finally is not run.
+var ErrQuit = errors.New("quit")
+
+// Action is what a Stepper wants done with a step.
+type Action int
+
+const (
+	// Continue runs the step. After the step failed, this accepts the failure, which is handled as it is without
+	// a Stepper.
+	Continue Action = iota
+	// Skip skips the step, which is recorded as Skipped. After the step failed, the failure is dropped.
+	Skip
+	// Retry runs the step again after it failed. Before the step is run, this is the same as Continue.
+	Retry
+	// Quit stops the run with ErrQuit.
+	Quit
+)
+
+// Step is a step in Seqs that a Stepper is asked about.
+type Step struct {
+	// Name is the name of the step. A step in a called config is named "[Call name]/[step name]".
+	Name string
+	// Cmd is the command of a Runner after template execution, which is empty for other steps. Changing it runs
+	// a different command for this attempt only. The new command is run the same way as a Cmd without a Shell,
+	// and can have templates. For a Pipeline, the stages are separated by an unquoted | word, as they are shown.
+	Cmd string
+	// Vals are the vals of the run, which the Stepper can change.
+	Vals map[string]string
+	// Render returns the command of a Runner after template execution with the current Vals, which is empty for
+	// other steps or if the templates have an error. This is how Cmd is set before the Stepper is called.
+	Render func() string
+	// Err is set when the step failed and the Stepper is asked what to do next.
+	Err error
+}
+
+// Stepper is called before each step in Seqs is run and again each time it fails. It returns what to do with the
+// step. An error fails the step.
+type Stepper func(s *Step) (Action, error)
+
+// WithStepper sets a Stepper, which is used to step through a run. Steps in OnFailure and Finally are not
+// stepped through.
+func WithStepper(s Stepper) Option {
+	return func(e *Executor) {
+		e.stepper = s
+	}
+}
+
+// stepRun runs "node", named "name", asking our Stepper about it first and again each time it fails. It
+// returns true if the Stepper or our BeforeStep skipped it. "childStartAt" is where to start inside it if it is a config.Call.
+func (e *Executor) stepRun(node *config.Sequence, name, childStartAt string) (bool, error) {
+	if e.stepper == nil {
+		err := e.runSeq(node, InSeqs, childStartAt)
+		if errors.Is(err, ErrSkipStep) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	s := &Step{Name: name, Vals: e.vals, Render: func() string { return "" }}
+	if r, ok := node.Item().(*config.Runner); ok {
+		s.Render = func() string {
+			c, err := e.baseCmd(r)
+			if err != nil {
+				return ""
+			}
+			return c.String()
+		}
+	}
+	for {
+		shown := s.Render()
+		s.Cmd = shown
+		action, err := e.stepper(s)
+		if err != nil {
+			return false, fmt.Errorf("step(%s): %w", name, err)
+		}
+		switch action {
+		case Skip:
+			fmt.Printf("Skipping(%s): %s: skipped while stepping\n", InSeqs, name)
+			return true, nil
+		case Quit:
+			return false, fmt.Errorf("step(%s): %w", name, ErrQuit)
+		case Continue:
+			if s.Err != nil {
+				return false, s.Err
+			}
+		}
+
+		// Only a changed Cmd overrides the Runner, so that a change to Vals alone is rendered into the command.
+		if s.Cmd != shown {
+			e.cmdOverride = s.Cmd
+		}
+		err = e.runSeq(node, InSeqs, childStartAt)
+		e.cmdOverride = ""
+		switch {
+		case errors.Is(err, ErrSkipStep):
+			return true, nil
+		case err == nil:
+			return false, nil
+		case paused(err):
+			// A Call was quit or needs approval inside, which is not a failure to ask about.
+			return false, err
+		}
+		s.Err = err
+	}
+}
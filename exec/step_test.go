@@ -0,0 +1,257 @@
+package exec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestStepper(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `
+[[Seqs]]
+	Name = "Greet"
+	Cmd = "echo hello"
+	ValueKey = "Greeting"
+
+[[Seqs]]
+	Name = "Flaky"
+	Cmd = "false"
+
+[[Seqs]]
+	Name = "Child"
+	Config = "child.toml"
+`,
+		"child.toml": `
+[[Required]]
+	Name = "Suite"
+	Default = "all"
+
+[[Seqs]]
+	Name = "Test"
+	Cmd = "echo {{ .Suite }}"
+	ValueKey = "Result"
+`,
+	}
+
+	tests := []struct {
+		desc         string
+		stepper      func(calls map[string]int) Stepper
+		wantErr      bool
+		wantQuit     bool
+		wantGreeting string
+		wantCalls    map[string]int
+		wantStatuses []string
+	}{
+		{
+			desc: "Continue accepts the failure",
+			stepper: func(calls map[string]int) Stepper {
+				return func(s *Step) (Action, error) {
+					calls[s.Name]++
+					return Continue, nil
+				}
+			},
+			wantErr:      true,
+			wantGreeting: "hello",
+			wantCalls:    map[string]int{"Greet": 1, "Flaky": 2},
+			wantStatuses: []string{"Seqs: Greet: Succeeded", "Seqs: Flaky: Failed"},
+		},
+		{
+			desc: "Skip before the step and after it fails",
+			stepper: func(calls map[string]int) Stepper {
+				return func(s *Step) (Action, error) {
+					calls[s.Name]++
+					switch {
+					case s.Name == "Greet":
+						return Skip, nil
+					case s.Err != nil:
+						return Skip, nil
+					}
+					return Continue, nil
+				}
+			},
+			wantCalls:    map[string]int{"Greet": 1, "Flaky": 2, "Child": 1, "Child/Test": 1},
+			wantStatuses: []string{"Seqs: Greet: Skipped", "Seqs: Flaky: Skipped", "Seqs: Child/Test: Succeeded", "Seqs: Child: Succeeded"},
+		},
+		{
+			desc: "Retry with a changed command",
+			stepper: func(calls map[string]int) Stepper {
+				return func(s *Step) (Action, error) {
+					calls[s.Name]++
+					switch {
+					case s.Name == "Greet":
+						if s.Cmd != "echo hello" {
+							return Quit, nil
+						}
+						s.Cmd = "echo {{ .Name }}"
+						s.Vals["Name"] = "changed"
+					case s.Err != nil:
+						s.Cmd = "true"
+						return Retry, nil
+					}
+					return Continue, nil
+				}
+			},
+			wantGreeting: "changed",
+			wantCalls:    map[string]int{"Greet": 1, "Flaky": 2, "Child": 1, "Child/Test": 1},
+			wantStatuses: []string{"Seqs: Greet: Succeeded", "Seqs: Flaky: Succeeded", "Seqs: Child/Test: Succeeded", "Seqs: Child: Succeeded"},
+		},
+		{
+			desc: "Changed variable renders the command",
+			stepper: func(calls map[string]int) Stepper {
+				return func(s *Step) (Action, error) {
+					calls[s.Name]++
+					switch s.Name {
+					case "Flaky":
+						return Skip, nil
+					case "Child/Test":
+						s.Vals["Suite"] = "unit"
+						if s.Render() != "echo unit" {
+							return Quit, nil
+						}
+						s.Cmd = s.Render()
+					}
+					return Continue, nil
+				}
+			},
+			wantGreeting: "hello",
+			wantCalls:    map[string]int{"Greet": 1, "Flaky": 1, "Child": 1, "Child/Test": 1},
+			wantStatuses: []string{"Seqs: Greet: Succeeded", "Seqs: Flaky: Skipped", "Seqs: Child/Test: Succeeded", "Seqs: Child: Succeeded"},
+		},
+		{
+			desc: "Quit in a Call",
+			stepper: func(calls map[string]int) Stepper {
+				return func(s *Step) (Action, error) {
+					calls[s.Name]++
+					switch s.Name {
+					case "Flaky":
+						return Skip, nil
+					case "Child/Test":
+						return Quit, nil
+					}
+					return Continue, nil
+				}
+			},
+			wantErr:      true,
+			wantQuit:     true,
+			wantGreeting: "hello",
+			wantCalls:    map[string]int{"Greet": 1, "Flaky": 1, "Child": 1, "Child/Test": 1},
+			wantStatuses: []string{"Seqs: Greet: Succeeded", "Seqs: Flaky: Skipped", "Seqs: Child/Test: Paused", "Seqs: Child: Paused"},
+		},
+	}
+
+	for _, test := range tests {
+		calls := map[string]int{}
+		e, err := testRun(t, files, WithStepper(test.stepper(calls)))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestStepper(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestStepper(%s): got err == %s, want err == nil", test.desc, err)
+		case test.wantQuit && !errors.Is(err, ErrQuit):
+			t.Errorf("TestStepper(%s): got err == %s, want %s", test.desc, err, ErrQuit)
+		}
+		if e.vals["Greeting"] != test.wantGreeting {
+			t.Errorf("TestStepper(%s): got Greeting %q, want %q", test.desc, e.vals["Greeting"], test.wantGreeting)
+		}
+		if diff := pretty.Compare(test.wantCalls, calls); diff != "" {
+			t.Errorf("TestStepper(%s): calls: -want/+got:\n%s", test.desc, diff)
+		}
+		if diff := pretty.Compare(test.wantStatuses, statuses(e)); diff != "" {
+			t.Errorf("TestStepper(%s): -want/+got:\n%s", test.desc, diff)
+		}
+	}
+}
+
+func TestStepperEdits(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `
+[[Required]]
+	Name = "Name"
+	Default = "before"
+
+[[Seqs]]
+	Name = "Greet"
+	Cmd = "echo {{ .Name }}"
+	ValueKey = "Out"
+
+[[Seqs]]
+	Name = "Pipe"
+	Pipeline = ["echo abc", "tr a z"]
+	ValueKey = "Piped"
+`,
+	}
+
+	tests := []struct {
+		desc      string
+		stepper   Stepper
+		wantErr   bool
+		wantOut   string
+		wantPiped string
+	}{
+		{
+			desc: "No edits",
+			stepper: func(s *Step) (Action, error) {
+				return Continue, nil
+			},
+			wantOut:   "before",
+			wantPiped: "zbc",
+		},
+		{
+			desc: "Changed Vals only",
+			stepper: func(s *Step) (Action, error) {
+				if s.Name == "Greet" {
+					s.Vals["Name"] = "after"
+				}
+				return Continue, nil
+			},
+			wantOut:   "after",
+			wantPiped: "zbc",
+		},
+		{
+			desc: "Changed Pipeline",
+			stepper: func(s *Step) (Action, error) {
+				if s.Name == "Pipe" {
+					if s.Cmd != "echo abc | tr a z" {
+						return Quit, nil
+					}
+					s.Cmd = "echo abc | tr b y | tr '|' x"
+				}
+				return Continue, nil
+			},
+			wantOut:   "before",
+			wantPiped: "ayc",
+		},
+		{
+			desc: "Changed Pipeline with an empty stage",
+			stepper: func(s *Step) (Action, error) {
+				if s.Name == "Pipe" {
+					if s.Err != nil {
+						return Quit, nil
+					}
+					s.Cmd = "echo abc | | tr b y"
+				}
+				return Continue, nil
+			},
+			wantErr: true,
+			wantOut: "before",
+		},
+	}
+
+	for _, test := range tests {
+		e, err := testRun(t, files, WithStepper(test.stepper))
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestStepperEdits(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestStepperEdits(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if e.vals["Out"] != test.wantOut {
+			t.Errorf("TestStepperEdits(%s): got Out %q, want %q", test.desc, e.vals["Out"], test.wantOut)
+		}
+		if e.vals["Piped"] != test.wantPiped {
+			t.Errorf("TestStepperEdits(%s): got Piped %q, want %q", test.desc, e.vals["Piped"], test.wantPiped)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/element-of-surprise/runme/internal/cmd"
+)
+
+// wait runs the Cmd "c" for Runner "r" every Interval until it succeeds and its output satisfies the
+// Runner's WaitUntil. A command still running at the Timeout is killed. On Timeout, the error has the last value
+// that was observed.
+func (e *Executor) wait(r *config.Runner, c *cmd.Cmd) (cmd.Output, error) {
+	w := r.WaitUntil
+	equals, err := e.render(w.Equals)
+	if err != nil {
+		return cmd.Output{}, fmt.Errorf("Runner(%s): WaitUntil Equals: %w", r.Name, err)
+	}
+
+	deadline := time.Now().Add(w.Timeout.Duration)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	for i := 1; ; i++ {
+		if i > 1 {
+			c, _, err = e.runnerCmd(r)
+			if err != nil {
+				return cmd.Output{}, err
+			}
+		}
+
+		// The command is killed at the deadline, and a condition that holds after it is too late.
+		out, err := e.attempt(ctx, r, c)
+		timedOut := ctx.Err() != nil
+		var value, why string
+		if err == nil {
+			var ok bool
+			value, ok, why = w.Check(out.Stdout, equals)
+			switch {
+			case ok && !timedOut:
+				return out, nil
+			case ok:
+				why = "the condition held after the Timeout"
+			}
+		} else {
+			value = strings.TrimSpace(string(out.Stdout))
+			why = fmt.Sprintf("cmd failed: %s", e.redact(err.Error()))
+		}
+		value = e.redact(value)
+		if len(value) > maxValueDetail {
+			value = value[:maxValueDetail] + "..."
+		}
+
+		if timedOut || time.Now().Add(w.Interval.Duration).After(deadline) {
+			return out, fmt.Errorf("Runner(%s): WaitUntil timed out after %s and %d attempts, %s, last value: %q", r.Name, w.Timeout, i, why, value)
+		}
+		fmt.Printf("Waiting for Runner(%s): attempt(%d): %s, value: %q, checking again in %s\n", r.Name, i, why, value, w.Interval)
+		time.Sleep(w.Interval.Duration)
+	}
+}
+
+// render executes "s" as a template with our vals.
+func (e *Executor) render(s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("").Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("violated a text/template rule: %s", err)
+	}
+	b := strings.Builder{}
+	if err := tmpl.Execute(&b, config.TemplateData(e.vals)); err != nil {
+		return "", fmt.Errorf("problem with template execution: %s", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/element-of-surprise/runme/config"
+)
+
+// fmtCmd implements "runme fmt", which rewrites TOML config files in canonical form.
+func fmtCmd(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	check := fs.Bool("check", false, "Do not write the files, list the files that are not formatted and exit with 1 if there are any.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: runme fmt [--check] [config files]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	code := 0
+	for _, p := range fs.Args() {
+		if config.FormatOf(p) != config.TOML {
+			fmt.Printf("Error: %s: only TOML configs can be formatted\n", p)
+			code = 1
+			continue
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			code = 1
+			continue
+		}
+		out, err := config.FormatTOML(b)
+		if err != nil {
+			fmt.Printf("Error: %s: %s\n", p, err)
+			code = 1
+			continue
+		}
+		if bytes.Equal(b, out) {
+			continue
+		}
+		if *check {
+			fmt.Println(p)
+			code = 1
+			continue
+		}
+		if err := os.WriteFile(p, out, 0644); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			code = 1
+		}
+	}
+	return code
+}
@@ -4,8 +4,12 @@ go 1.17
 
 require (
 	github.com/BurntSushi/toml v1.0.0
+	github.com/creack/pty v1.1.18
 	github.com/google/uuid v1.2.0
 	github.com/gopherfs/fs v0.0.0-20220204202500-4538e04c7abb
 	github.com/kylelemons/godebug v1.1.0
 	github.com/silas/dag v0.0.0-20211117232152-9d50aa809f35
+	golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1
+	golang.org/x/term v0.0.0-20220526004731-065cf7ba2467
+	gopkg.in/yaml.v3 v3.0.1
 )
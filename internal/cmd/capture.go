@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+)
+
+// capture captures the output of a command. Output past max bytes is either dropped or, if spill is set,
+// the whole output is written to the file at spill instead of being kept in memory.
+type capture struct {
+	// max is the most bytes kept in memory. 0 means there is no limit.
+	max int64
+	// spill is the path of the file output is written to once it is larger than max.
+	spill string
+
+	buf  bytes.Buffer
+	n    int64
+	file *os.File
+	err  error
+}
+
+// Write implements io.Writer. This never returns an error, so a command is never stopped because we
+// can't keep its output. Errors writing the spill file are returned by close().
+func (c *capture) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	switch {
+	case c.err != nil:
+	case c.file != nil:
+		_, c.err = c.file.Write(p)
+	case c.max == 0 || int64(c.buf.Len()+len(p)) <= c.max:
+		c.buf.Write(p)
+	case c.spill != "":
+		c.file, c.err = os.OpenFile(c.spill, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if c.err != nil {
+			break
+		}
+		if _, c.err = c.file.Write(c.buf.Bytes()); c.err == nil {
+			_, c.err = c.file.Write(p)
+		}
+		c.buf.Reset()
+	default:
+		c.buf.Write(p[:c.max-int64(c.buf.Len())])
+	}
+	return len(p), nil
+}
+
+// truncated returns true if output was dropped.
+func (c *capture) truncated() bool {
+	return c.file == nil && c.max > 0 && c.n > c.max
+}
+
+// close closes the spill file, if there is one, and returns any error from writing it.
+func (c *capture) close() error {
+	if c.file != nil {
+		if err := c.file.Close(); err != nil && c.err == nil {
+			c.err = err
+		}
+	}
+	return c.err
+}
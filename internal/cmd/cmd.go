@@ -1,69 +1,135 @@
 package cmd
 
 import (
-	"log"
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
 	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/element-of-surprise/runme/internal/parser"
 )
 
+// ErrNotTerminal is returned by RunInteractive when runme is not run from a terminal.
+var ErrNotTerminal = errors.New("runme must be run from a terminal to run a command interactively")
+
 // Cmd is a wrapper for exec.Cmd to allow for more elegant construction for the
 // purposes of this package.
 type Cmd struct {
-	cmd   *exec.Cmd
+	cmd  *exec.Cmd
 	args []string
-	debug bool
+	// stages are set instead of cmd when the Cmd is a pipeline. The stdout of each stage
+	// is connected to the stdin of the next.
+	stages []*Cmd
+	debug  bool
+	// max is the most bytes of stdout and of stderr that are kept, 0 for no limit.
+	max int64
+	// spill is the path, without extension, of the files that output larger than max is written to.
+	spill string
 }
 
-// New creates a Cmd out of the string "s" with value substitutions from vals.
-func New(s string, vals map[string]string) (*Cmd, error) {
+// New creates a Cmd out of the string "s" with value substitutions from "data", which is usually the map of our vals.
+// The whole of "s" is a single text/template, so actions can span more than one argument. A substituted value is
+// always part of a single argument. Use {{ args .List }} to turn a value into multiple arguments.
+func New(s string, data interface{}) (*Cmd, error) {
 	p := parser.Line{}
-	args, err := p.Parse(s)
+	src, err := p.Template(s)
 	if err != nil {
 		return nil, fmt.Errorf("command(%s) could not be parsed: %s", s, err)
 	}
-	b := strings.Builder{}
-	for i, arg := range args[1:] {
-		b.Reset()
-		tmpl, err := template.New("").Parse(arg)
-		if err != nil {
-			return nil, fmt.Errorf("arg(%s) violated a text/template rule: %s\n template looks like:\n%s", arg, err, strings.Join(args, " "))
-		}
-		if err := tmpl.Execute(&b, vals); err != nil {
-			return nil, fmt.Errorf("problem with template execution: %s", err)
+	tmpl, err := template.New("").Funcs(parser.Funcs).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("command(%s) violated a text/template rule: %s", s, err)
+	}
+	// Every value is checked so that it cannot change how the output is split into args.
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			endActions(t.Tree, t.Tree.Root, parser.ValueFunc, "args")
 		}
-		s := b.String()
+	}
+	b := strings.Builder{}
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("command(%s): problem with template execution: %s", s, err)
+	}
+	args := parser.Split(b.String())
+	if len(args) < 1 || args[0] == "" {
+		return nil, fmt.Errorf("command(%s) has no program name after template execution", s)
+	}
 
-		// Okay.... shell uses quotes of either ' or " to wrap a mutli-space arguement as a single arugement. But exec.Cmd doesn't, so you need
-		// to remove outer quotes, if they exist.
-		if strings.HasPrefix(s, `"`) {
-			s = strings.TrimPrefix(s, `"`)
-			s = strings.TrimSuffix(s, `"`)
-		}else if strings.HasPrefix(s, `'`){
-			s = strings.TrimPrefix(s, `'`)
-			s = strings.TrimSuffix(s, `'`)
+	return newCmd(args), nil
+}
+
+// NewPipeline creates a Cmd that runs each of "stages" with the stdout of a stage connected to the stdin of
+// the next, like a shell pipeline. Each stage is made the same way as New. The output is the stdout of the last
+// stage and the stderr of all stages.
+func NewPipeline(stages []string, data interface{}) (*Cmd, error) {
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("a pipeline must have at least one stage")
+	}
+	c := &Cmd{debug: true}
+	for i, s := range stages {
+		stage, err := New(s, data)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline stage(%d): %w", i, err)
 		}
+		c.stages = append(c.stages, stage)
+	}
+	return c, nil
+}
 
-		args[i+1] = s
+// ParsePipeline creates a pipeline from the line "s", where the stages are separated by an unquoted | word
+// as String shows them. Each stage is parsed the same as New.
+func ParsePipeline(s string, data interface{}) (*Cmd, error) {
+	p := parser.Line{}
+	stages, err := p.Stages(s)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline(%s) could not be parsed: %s", s, err)
 	}
+	return NewPipeline(stages, data)
+}
 
-	log.Printf("args: %#+v", args)
+func newCmd(args []string) *Cmd {
 	c := &Cmd{
 		cmd:   exec.Command(args[0], args[1:]...),
-		args: args,
+		args:  args,
 		debug: true,
 	}
-	return c.BaseEnv(), nil
+	return c.BaseEnv()
 }
 
+// String returns the command as a line that lexes back into the same args. Args that are not made up of only
+// safe characters are single quoted. A pipeline has its stages separated by |.
 func (c *Cmd) String() string {
-	return strings.Join(c.args, " ")
+	if c.stages != nil {
+		stages := make([]string, 0, len(c.stages))
+		for _, s := range c.stages {
+			stages = append(stages, s.String())
+		}
+		return strings.Join(stages, " | ")
+	}
+
+	args := make([]string, 0, len(c.args))
+	for _, a := range c.args {
+		args = append(args, Quote(a))
+	}
+	return strings.Join(args, " ")
+}
+
+// safeRE matches strings that do not need to be quoted for a POSIX shell or our lexer.
+var safeRE = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Quote returns "s" quoted so that a POSIX shell sees it as a single word with no expansion. Strings
+// that only have safe characters are returned as is.
+func Quote(s string) string {
+	if safeRE.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
 }
 
 // Debug if set to on will send the command stdout and stderr to the os.Stdout and os.Stderr.
@@ -76,12 +142,68 @@ func (c *Cmd) Debug(on bool) *Cmd {
 
 // Env allows appending to the underling exec.Cmd.Env value.
 func (c *Cmd) Env(env ...string) *Cmd {
+	if c.stages != nil {
+		for _, s := range c.stages {
+			s.Env(env...)
+		}
+		return c
+	}
 	c.cmd.Env = append(c.cmd.Env, env...)
 	return c
 }
 
+// Dir sets the directory the command is run in.
+func (c *Cmd) Dir(dir string) *Cmd {
+	if c.stages != nil {
+		for _, s := range c.stages {
+			s.Dir(dir)
+		}
+		return c
+	}
+	c.cmd.Dir = dir
+	return c
+}
+
+// Stdin sets the stdin of the command to "r". For a pipeline, this is the stdin of the first stage.
+// If "r" is an io.Closer, it is closed when Run returns.
+func (c *Cmd) Stdin(r io.Reader) *Cmd {
+	if c.stages != nil {
+		c.stages[0].Stdin(r)
+		return c
+	}
+	c.cmd.Stdin = r
+	return c
+}
+
+// Limit limits the stdout and the stderr kept by Run to "max" bytes each. If "spill" is set, output larger than
+// "max" is written to the file spill+".stdout" or spill+".stderr" instead. Otherwise the output is truncated.
+func (c *Cmd) Limit(max int64, spill string) *Cmd {
+	c.max = max
+	c.spill = spill
+	return c
+}
+
+// ClearEnv removes all variables from the underlying exec.Cmd.Env value, so the command only gets
+// variables added with Env.
+func (c *Cmd) ClearEnv() *Cmd {
+	if c.stages != nil {
+		for _, s := range c.stages {
+			s.ClearEnv()
+		}
+		return c
+	}
+	c.cmd.Env = []string{}
+	return c
+}
+
 // BaseEnv replaces the current exec.Cmd.Env and sets up GOPATH, HOME, and PATH.
 func (c *Cmd) BaseEnv() *Cmd {
+	if c.stages != nil {
+		for _, s := range c.stages {
+			s.BaseEnv()
+		}
+		return c
+	}
 	c.cmd.Env = []string{
 		"GOPATH=" + os.Getenv("GOPATH"),
 		"HOME=" + os.Getenv("HOME"),
@@ -90,23 +212,206 @@ func (c *Cmd) BaseEnv() *Cmd {
 	return c
 }
 
+// Output is the output of a command.
+type Output struct {
+	// Stdout is the stdout of the command. For a pipeline, this is the stdout of the last stage.
+	Stdout []byte
+	// Stderr is the stderr of the command. For a pipeline, this is the stderr of all stages.
+	Stderr []byte
+	// ExitCode is the exit code of the command. For a pipeline, this is the exit code of the last stage that
+	// failed. This is -1 if the command could not be run or was killed by a signal.
+	ExitCode int
+	// StdoutFile and StderrFile are set to the file the output was written to when it was larger than the Limit
+	// and a spill file was set. Stdout or Stderr is empty when this is set.
+	StdoutFile, StderrFile string
+	// StdoutTruncated and StderrTruncated are true if the output was larger than the Limit and was truncated.
+	StdoutTruncated, StderrTruncated bool
+}
+
 // Run executes the command
-func (c *Cmd) Run() ([]byte, error) {
-	buff := &bytes.Buffer{}
+func (c *Cmd) Run() (Output, error) {
+	return c.RunContext(context.Background())
+}
+
+// RunContext executes the command, killing it if "ctx" is done before it exits. The error then wraps the
+// error of "ctx".
+func (c *Cmd) RunContext(ctx context.Context) (Output, error) {
+	if closer, ok := c.first().Stdin.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	outCap, errCap := &capture{max: c.max}, &capture{max: c.max}
+	if c.spill != "" {
+		outCap.spill, errCap.spill = c.spill+".stdout", c.spill+".stderr"
+	}
+	var stdout, stderr io.Writer = outCap, errCap
 	if c.debug {
-		c.cmd.Stderr = io.MultiWriter(buff, os.Stderr)
-		c.cmd.Stdout = io.MultiWriter(buff, os.Stdout)
+		stderr = io.MultiWriter(errCap, os.Stderr)
+		stdout = io.MultiWriter(outCap, os.Stdout)
+	}
+
+	var err error
+	if c.stages != nil {
+		// Stages write to stderr at the same time.
+		stderr = &lockedWriter{w: stderr}
+		err = c.runPipeline(ctx, stdout, stderr)
 	} else {
-		c.cmd.Stderr = buff
-		c.cmd.Stdout = buff
+		c.cmd.Stderr = stderr
+		c.cmd.Stdout = stdout
+		killable(ctx, c.cmd)
+		err = c.cmd.Start()
+		if err == nil {
+			stop := kill(ctx, c.cmd)
+			err = c.cmd.Wait()
+			stop()
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("command was killed: %w", ctx.Err())
+	}
+
+	out := Output{
+		Stdout:          outCap.buf.Bytes(),
+		Stderr:          errCap.buf.Bytes(),
+		StdoutTruncated: outCap.truncated(),
+		StderrTruncated: errCap.truncated(),
+	}
+	if outCap.file != nil {
+		out.StdoutFile = outCap.spill
+	}
+	if errCap.file != nil {
+		out.StderrFile = errCap.spill
+	}
+	if err != nil {
+		out.ExitCode = -1
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) {
+			out.ExitCode = exitErr.ExitCode()
+		}
 	}
-	if err := c.cmd.Run(); err != nil {
-		return buff.Bytes(), err
+
+	for _, c := range []*capture{outCap, errCap} {
+		if cerr := c.close(); cerr != nil && err == nil {
+			err = fmt.Errorf("could not write output to file(%s): %w", c.spill, cerr)
+		}
 	}
-	return buff.Bytes(), nil
+	return out, err
 }
 
-// Exec returns the underlying *exec.Cmd.
+// runPipeline runs all the stages of a pipeline. If more than one stage fails, the error is from
+// the last stage that failed, the same as a shell with pipefail set.
+func (c *Cmd) runPipeline(ctx context.Context, stdout, stderr io.Writer) error {
+	// pipes are the ends of the pipes between stages, which we close once the stages have them.
+	pipes := []*os.File{}
+	closePipes := func() {
+		for _, p := range pipes {
+			p.Close()
+		}
+	}
+
+	for i, s := range c.stages {
+		s.cmd.Stderr = stderr
+		if i == len(c.stages)-1 {
+			s.cmd.Stdout = stdout
+			break
+		}
+		r, w, err := os.Pipe()
+		if err != nil {
+			closePipes()
+			return fmt.Errorf("could not create a pipe between stages: %w", err)
+		}
+		pipes = append(pipes, r, w)
+		s.cmd.Stdout = w
+		c.stages[i+1].cmd.Stdin = r
+	}
+
+	// Stages are named by their index in errors, as their args can have secrets.
+	started := []*Cmd{}
+	var startErr error
+	for i, s := range c.stages {
+		killable(ctx, s.cmd)
+		if err := s.cmd.Start(); err != nil {
+			startErr = fmt.Errorf("stage(%d) could not be started: %w", i, err)
+			break
+		}
+		started = append(started, s)
+	}
+	closePipes()
+
+	cmds := make([]*exec.Cmd, 0, len(started))
+	for _, s := range started {
+		cmds = append(cmds, s.cmd)
+	}
+	stop := kill(ctx, cmds...)
+	defer stop()
+
+	var err error
+	for i, s := range started {
+		if werr := s.cmd.Wait(); werr != nil {
+			err = fmt.Errorf("stage(%d): %w", i, werr)
+		}
+	}
+	if startErr != nil {
+		return startErr
+	}
+	return err
+}
+
+// killable sets up "cmds" so that kill also kills the processes they start, if "ctx" can be done. It must be called
+// before they are started. Commands that can't be killed stay in our process group, so a Ctrl-C still reaches them.
+func killable(ctx context.Context, cmds ...*exec.Cmd) {
+	if ctx.Done() == nil {
+		return
+	}
+	for _, c := range cmds {
+		setProcGroup(c)
+		setWaitDelay(c)
+	}
+}
+
+// kill kills "cmds" and the processes they started, if "ctx" is done before the returned func is called. "cmds" must
+// have been set up by killable and started. The returned func must be called once the cmds have exited.
+func kill(ctx context.Context, cmds ...*exec.Cmd) func() {
+	if ctx.Done() == nil || len(cmds) == 0 {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			for _, c := range cmds {
+				killProc(c)
+			}
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// first returns the underlying *exec.Cmd that reads our stdin. For a pipeline, this is the first stage.
+func (c *Cmd) first() *exec.Cmd {
+	if c.stages != nil {
+		return c.stages[0].cmd
+	}
+	return c.cmd
+}
+
+// Exec returns the underlying *exec.Cmd. For a pipeline, this is the last stage.
 func (c *Cmd) Exec() *exec.Cmd {
+	if c.stages != nil {
+		return c.stages[len(c.stages)-1].cmd
+	}
 	return c.cmd
 }
+
+// lockedWriter is an io.Writer that can be written to by more than one goroutine.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,572 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestNew(t *testing.T) {
+	vals := map[string]string{
+		"Name":     "my group",
+		"Empty":    "",
+		"Debug":    "true",
+		"List":     `["a b", "c", ""]`,
+		"Words":    "x y  z",
+		"Quote":    `it's`,
+		"Mustache": "{{ .Name }}",
+		"Nul":      "a\x00b",
+		"Mark":     "\x01",
+	}
+
+	tests := []struct {
+		desc    string
+		cmd     string
+		want    []string
+		wantStr string
+		err     bool
+	}{
+		{
+			desc:    "Value with spaces stays one arg",
+			cmd:     `az group create --name {{ .Name }}`,
+			want:    []string{"az", "group", "create", "--name", "my group"},
+			wantStr: `az group create --name 'my group'`,
+		},
+		{
+			desc: "Value joined to text",
+			cmd:  `echo --name={{ .Name }}-1`,
+			want: []string{"echo", "--name=my group-1"},
+		},
+		{
+			desc: "Template with spaces",
+			cmd:  `echo {{ printf "%s %s" .Name .Debug }}`,
+			want: []string{"echo", "my group true"},
+		},
+		{
+			desc: "if spanning args that is true",
+			cmd:  `echo {{ if .Debug }}--debug --level 3{{ end }} done`,
+			want: []string{"echo", "--debug", "--level", "3", "done"},
+		},
+		{
+			desc: "if spanning args that is false",
+			cmd:  `echo {{ if .Empty }}--debug --level 3{{ end }} done`,
+			want: []string{"echo", "done"},
+		},
+		{
+			desc: "Unquoted empty value is removed",
+			cmd:  `echo {{ .Empty }} done`,
+			want: []string{"echo", "done"},
+		},
+		{
+			desc:    "Quoted empty value is kept",
+			cmd:     `echo "{{ .Empty }}" done`,
+			want:    []string{"echo", "", "done"},
+			wantStr: `echo '' done`,
+		},
+		{
+			desc: "args with a JSON array",
+			cmd:  `echo {{ args .List }} done`,
+			want: []string{"echo", "a b", "c", "", "done"},
+		},
+		{
+			desc: "args with words",
+			cmd:  `echo {{ args .Words }}`,
+			want: []string{"echo", "x", "y", "z"},
+		},
+		{
+			desc: "args with an empty value",
+			cmd:  `echo {{ args .Empty }} done`,
+			want: []string{"echo", "done"},
+		},
+		{
+			desc:    "Value with a quote",
+			cmd:     `echo {{ .Quote }}`,
+			want:    []string{"echo", "it's"},
+			wantStr: `echo 'it'\''s'`,
+		},
+		{
+			desc: "Value is not executed again",
+			cmd:  `echo {{ .Mustache }}`,
+			want: []string{"echo", "{{ .Name }}"},
+		},
+		{
+			desc: "Single quoted template is text",
+			cmd:  `echo '{{ .Name }}'`,
+			want: []string{"echo", "{{ .Name }}"},
+		},
+		{
+			desc: "Bad template",
+			cmd:  `echo {{ if .Name }}`,
+			err:  true,
+		},
+		{
+			desc: "No program after execution",
+			cmd:  `{{ .Empty }}`,
+			err:  true,
+		},
+		{
+			desc: "Value with a NUL",
+			cmd:  `echo {{ .Nul }}`,
+			err:  true,
+		},
+		{
+			desc: "Value with a NUL in a template",
+			cmd:  `echo {{ printf "%s-%s" .Name .Nul }}`,
+			err:  true,
+		},
+		{
+			desc: "Value with a keep mark",
+			cmd:  `echo {{ .Mark }} done`,
+			err:  true,
+		},
+		{
+			desc: "args with a keep mark",
+			cmd:  `echo {{ args .Mark }} done`,
+			err:  true,
+		},
+	}
+
+	for _, test := range tests {
+		c, err := New(test.cmd, vals)
+		switch {
+		case err == nil && test.err:
+			t.Errorf("TestNew(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.err:
+			t.Errorf("TestNew(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		if diff := pretty.Compare(test.want, c.args); diff != "" {
+			t.Errorf("TestNew(%s): -want/+got:\n%s", test.desc, diff)
+		}
+		if test.wantStr != "" && c.String() != test.wantStr {
+			t.Errorf("TestNew(%s): got String() == %s, want %s", test.desc, c.String(), test.wantStr)
+		}
+	}
+}
+
+func TestNewShell(t *testing.T) {
+	vals := map[string]string{
+		"Name":  "my $HOME; rm -rf /",
+		"Flags": "-n",
+		"List":  `["a b", "c"]`,
+	}
+
+	tests := []struct {
+		desc    string
+		shell   string
+		script  string
+		want    string
+		wantErr bool
+	}{
+		{
+			desc:   "Value is quoted",
+			shell:  "sh",
+			script: `echo {{ .Name }}`,
+			want:   "my $HOME; rm -rf /\n",
+		},
+		{
+			desc:   "Pipe and redirection",
+			shell:  "bash",
+			script: `echo {{ .Name }} | tr a-z A-Z 2>/dev/null`,
+			want:   "MY $HOME; RM -RF /\n",
+		},
+		{
+			desc:   "raw is not quoted",
+			shell:  "sh",
+			script: `echo {{ raw .Flags }} x`,
+			want:   "x",
+		},
+		{
+			desc:   "args quotes each element",
+			shell:  "sh",
+			script: `printf '%s|' {{ args .List }}`,
+			want:   "a b|c|",
+		},
+		{
+			desc:   "Actions in an if",
+			shell:  "sh",
+			script: `echo {{ if .Name }}{{ .Name }}{{ end }}`,
+			want:   "my $HOME; rm -rf /\n",
+		},
+		{
+			desc:    "pipefail with bash",
+			shell:   "bash",
+			script:  `false | cat`,
+			wantErr: true,
+		},
+		{
+			desc:    "Unknown shell",
+			shell:   "zsh",
+			script:  `echo`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		c, err := NewShell(test.shell, test.script, vals)
+		if err == nil {
+			var out Output
+			out, err = c.Debug(false).Run()
+			if err == nil && string(out.Stdout) != test.want {
+				t.Errorf("TestNewShell(%s): got %q, want %q", test.desc, string(out.Stdout), test.want)
+			}
+		}
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestNewShell(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestNewShell(%s): got err == %s, want err == nil", test.desc, err)
+		}
+	}
+}
+
+func TestNewPipeline(t *testing.T) {
+	vals := map[string]string{"Want": "b c"}
+
+	tests := []struct {
+		desc    string
+		stages  []string
+		want    string
+		wantStr string
+		wantErr bool
+	}{
+		{
+			desc:    "Two stages",
+			stages:  []string{`printf 'a\nb c\nd\n'`, `grep {{ .Want }}`},
+			want:    "b c\n",
+			wantStr: `printf 'a\nb c\nd\n' | grep 'b c'`,
+		},
+		{
+			desc:   "Three stages",
+			stages: []string{`printf 'a\nb\n'`, `tr a-z A-Z`, `head -n 1`},
+			want:   "A\n",
+		},
+		{
+			desc:    "A failed stage fails the pipeline",
+			stages:  []string{`false`, `cat`},
+			wantErr: true,
+		},
+		{
+			desc:    "A stage that can't start",
+			stages:  []string{`printf a`, `/does/not/exist`},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		c, err := NewPipeline(test.stages, vals)
+		if err != nil {
+			t.Errorf("TestNewPipeline(%s): got err == %s", test.desc, err)
+			continue
+		}
+		if test.wantStr != "" && c.String() != test.wantStr {
+			t.Errorf("TestNewPipeline(%s): got String() == %s, want %s", test.desc, c.String(), test.wantStr)
+		}
+
+		out, err := c.Debug(false).Run()
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestNewPipeline(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestNewPipeline(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if string(out.Stdout) != test.want {
+			t.Errorf("TestNewPipeline(%s): got %q, want %q", test.desc, string(out.Stdout), test.want)
+		}
+	}
+}
+
+func TestParsePipeline(t *testing.T) {
+	tests := []struct {
+		desc    string
+		line    string
+		want    string
+		wantErr bool
+	}{
+		{
+			desc: "As String shows it",
+			line: `printf 'a\nb c\nd\n' | grep 'b c'`,
+			want: "b c\n",
+		},
+		{
+			desc: "A quoted | is an arg",
+			line: `echo '|' a|b | tr a-z A-Z`,
+			want: "| A|B\n",
+		},
+		{
+			desc:    "Empty stage",
+			line:    `echo a | | cat`,
+			wantErr: true,
+		},
+		{
+			desc:    "Ends with |",
+			line:    `echo a |`,
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		c, err := ParsePipeline(test.line, nil)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestParsePipeline(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestParsePipeline(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		out, err := c.Debug(false).Run()
+		if err != nil {
+			t.Errorf("TestParsePipeline(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		}
+		if string(out.Stdout) != test.want {
+			t.Errorf("TestParsePipeline(%s): got %q, want %q", test.desc, string(out.Stdout), test.want)
+		}
+	}
+}
+
+// closeReader records if it was closed.
+type closeReader struct {
+	*strings.Reader
+	closed bool
+}
+
+func (c *closeReader) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestStdin(t *testing.T) {
+	single, err := New("cat", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipe, err := NewPipeline([]string{"cat", "tr a-z A-Z"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc string
+		cmd  *Cmd
+		want string
+	}{
+		{desc: "Single command", cmd: single, want: "kind: Pod"},
+		{desc: "Pipeline", cmd: pipe, want: "KIND: POD"},
+	}
+
+	for _, test := range tests {
+		r := &closeReader{Reader: strings.NewReader("kind: Pod")}
+		out, err := test.cmd.Stdin(r).Debug(false).Run()
+		if err != nil {
+			t.Errorf("TestStdin(%s): got err == %s", test.desc, err)
+			continue
+		}
+		if string(out.Stdout) != test.want {
+			t.Errorf("TestStdin(%s): got %q, want %q", test.desc, string(out.Stdout), test.want)
+		}
+		if !r.closed {
+			t.Errorf("TestStdin(%s): stdin was not closed", test.desc)
+		}
+	}
+}
+
+func TestRunOutput(t *testing.T) {
+	tests := []struct {
+		desc       string
+		cmd        func() (*Cmd, error)
+		wantStdout string
+		wantStderr string
+		wantCode   int
+		wantErr    bool
+	}{
+		{
+			desc:       "stdout and stderr are separate",
+			cmd:        func() (*Cmd, error) { return NewShell("sh", "echo out; echo warning >&2", nil) },
+			wantStdout: "out\n",
+			wantStderr: "warning\n",
+		},
+		{
+			desc:       "Exit code",
+			cmd:        func() (*Cmd, error) { return NewShell("sh", "echo out; exit 3", nil) },
+			wantStdout: "out\n",
+			wantCode:   3,
+			wantErr:    true,
+		},
+		{
+			desc: "Pipeline stderr from all stages and exit code of the last failure",
+			cmd: func() (*Cmd, error) {
+				return NewPipeline([]string{`sh -c "echo a >&2; exit 2"`, `sh -c "echo b >&2; cat"`}, nil)
+			},
+			wantCode: 2,
+			wantErr:  true,
+		},
+		{
+			desc:     "Program does not exist",
+			cmd:      func() (*Cmd, error) { return New("/does/not/exist", nil) },
+			wantCode: -1,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		c, err := test.cmd()
+		if err != nil {
+			t.Fatalf("TestRunOutput(%s): %s", test.desc, err)
+		}
+		out, err := c.Debug(false).Run()
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestRunOutput(%s): got err == nil, want err != nil", test.desc)
+		case err != nil && !test.wantErr:
+			t.Errorf("TestRunOutput(%s): got err == %s, want err == nil", test.desc, err)
+		}
+		if string(out.Stdout) != test.wantStdout {
+			t.Errorf("TestRunOutput(%s): got Stdout %q, want %q", test.desc, string(out.Stdout), test.wantStdout)
+		}
+		if test.wantStderr != "" && string(out.Stderr) != test.wantStderr {
+			t.Errorf("TestRunOutput(%s): got Stderr %q, want %q", test.desc, string(out.Stderr), test.wantStderr)
+		}
+		if out.ExitCode != test.wantCode {
+			t.Errorf("TestRunOutput(%s): got ExitCode %d, want %d", test.desc, out.ExitCode, test.wantCode)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	tests := []struct {
+		desc string
+		cmd  func() (*Cmd, error)
+	}{
+		{
+			desc: "Cmd",
+			cmd:  func() (*Cmd, error) { return New("sleep 5", nil) },
+		},
+		{
+			desc: "Pipeline",
+			cmd:  func() (*Cmd, error) { return NewPipeline([]string{"sleep 5", "cat"}, nil) },
+		},
+		{
+			desc: "Shell with a background command",
+			cmd:  func() (*Cmd, error) { return NewShell("sh", "sleep 5 & sleep 5", nil) },
+		},
+		{
+			desc: "Pipeline with a background command",
+			cmd:  func() (*Cmd, error) { return NewPipeline([]string{`sh -c "sleep 5 & sleep 5"`, "cat"}, nil) },
+		},
+	}
+
+	for _, test := range tests {
+		c, err := test.cmd()
+		if err != nil {
+			t.Fatalf("TestRunContext(%s): %s", test.desc, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		out, err := c.Debug(false).RunContext(ctx)
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("TestRunContext(%s): got err == %v, want context.DeadlineExceeded", test.desc, err)
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("TestRunContext(%s): the command was not killed, it ran for %s", test.desc, d)
+		}
+		if out.ExitCode != -1 {
+			t.Errorf("TestRunContext(%s): got ExitCode %d, want -1", test.desc, out.ExitCode)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		desc          string
+		script        string
+		max           int64
+		spill         string
+		wantStdout    string
+		wantTruncated bool
+		wantFile      string
+		wantFileData  string
+	}{
+		{
+			desc:       "Under the limit",
+			script:     "printf 12345",
+			max:        5,
+			wantStdout: "12345",
+		},
+		{
+			desc:          "Truncated",
+			script:        "printf 123; printf 456",
+			max:           5,
+			wantStdout:    "12345",
+			wantTruncated: true,
+		},
+		{
+			desc:         "Spilled",
+			script:       "printf 123; printf 456",
+			max:          5,
+			spill:        filepath.Join(dir, "step"),
+			wantFile:     filepath.Join(dir, "step.stdout"),
+			wantFileData: "123456",
+		},
+		{
+			desc:       "Spill not needed",
+			script:     "printf 123",
+			max:        5,
+			spill:      filepath.Join(dir, "small"),
+			wantStdout: "123",
+		},
+	}
+
+	for _, test := range tests {
+		c, err := NewShell("sh", test.script, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := c.Limit(test.max, test.spill).Debug(false).Run()
+		if err != nil {
+			t.Errorf("TestLimit(%s): got err == %s", test.desc, err)
+			continue
+		}
+		if string(out.Stdout) != test.wantStdout {
+			t.Errorf("TestLimit(%s): got Stdout %q, want %q", test.desc, string(out.Stdout), test.wantStdout)
+		}
+		if out.StdoutTruncated != test.wantTruncated {
+			t.Errorf("TestLimit(%s): got StdoutTruncated %v, want %v", test.desc, out.StdoutTruncated, test.wantTruncated)
+		}
+		if out.StdoutFile != test.wantFile {
+			t.Errorf("TestLimit(%s): got StdoutFile %q, want %q", test.desc, out.StdoutFile, test.wantFile)
+		}
+		if test.wantFile == "" {
+			continue
+		}
+		b, err := os.ReadFile(test.wantFile)
+		if err != nil {
+			t.Errorf("TestLimit(%s): %s", test.desc, err)
+			continue
+		}
+		if string(b) != test.wantFileData {
+			t.Errorf("TestLimit(%s): got file content %q, want %q", test.desc, string(b), test.wantFileData)
+		}
+	}
+}
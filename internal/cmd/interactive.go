@@ -0,0 +1,127 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// RunInteractive runs the command in a pseudo-terminal attached to runme's terminal, so the user can interact
+// with it. Everything the command writes to the terminal is also written to "transcript", if set, and returned
+// as Stdout, with the terminal's line endings of "\r\n" turned into "\n". Stderr and the input echoed by the terminal are
+// part of Stdout. This returns ErrNotTerminal if runme's stdin and stdout are not a terminal.
+func (c *Cmd) RunInteractive(transcript io.Writer) (Output, error) {
+	if c.stages != nil {
+		return Output{ExitCode: -1}, errors.New("a pipeline cannot be run interactively")
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return Output{ExitCode: -1}, ErrNotTerminal
+	}
+
+	ptmx, err := pty.Start(c.cmd)
+	if err != nil {
+		return Output{ExitCode: -1}, fmt.Errorf("could not start the command in a pseudo-terminal: %w", err)
+	}
+	defer ptmx.Close()
+
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	go func() {
+		for range resize {
+			pty.InheritSize(os.Stdin, ptmx)
+		}
+	}()
+	resize <- syscall.SIGWINCH
+	defer func() {
+		signal.Stop(resize)
+		close(resize)
+	}()
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return Output{ExitCode: -1}, fmt.Errorf("could not put the terminal in raw mode: %w", err)
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	done := make(chan struct{})
+	stdinDone := make(chan struct{})
+	go func() {
+		defer close(stdinDone)
+		copyStdin(ptmx, done)
+	}()
+
+	outCap := &capture{max: c.max}
+	if c.spill != "" {
+		outCap.spill = c.spill + ".stdout"
+	}
+	w := io.MultiWriter(os.Stdout, outCap)
+	if transcript != nil {
+		w = io.MultiWriter(os.Stdout, outCap, transcript)
+	}
+	// This returns an error when the command exits and the pseudo-terminal is closed, which is expected.
+	io.Copy(w, ptmx)
+
+	err = c.cmd.Wait()
+	close(done)
+	<-stdinDone
+
+	out := Output{Stdout: bytes.ReplaceAll(outCap.buf.Bytes(), []byte("\r\n"), []byte("\n")), StdoutTruncated: outCap.truncated()}
+	if outCap.file != nil {
+		out.StdoutFile = outCap.spill
+	}
+	if err != nil {
+		out.ExitCode = -1
+		exitErr := &exec.ExitError{}
+		if errors.As(err, &exitErr) {
+			out.ExitCode = exitErr.ExitCode()
+		}
+	}
+	if cerr := outCap.close(); cerr != nil && err == nil {
+		err = fmt.Errorf("could not write output to file(%s): %w", outCap.spill, cerr)
+	}
+	return out, err
+}
+
+// copyStdin copies our stdin to "w" until "done" is closed. This polls stdin so that it never blocks in a read
+// after the command is done, which would take input meant for whatever reads stdin next.
+func copyStdin(w io.Writer, done chan struct{}) {
+	fd := int(os.Stdin.Fd())
+	buf := make([]byte, 1024)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		n, err := unix.Poll(fds, 100)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) {
+				continue
+			}
+			return
+		}
+		if n == 0 || fds[0].Revents&unix.POLLIN == 0 {
+			continue
+		}
+		r, err := unix.Read(fd, buf)
+		if err != nil || r == 0 {
+			return
+		}
+		if _, err := w.Write(buf[:r]); err != nil {
+			return
+		}
+	}
+}
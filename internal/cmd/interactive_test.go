@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"golang.org/x/term"
+)
+
+func TestRunInteractiveNotTerminal(t *testing.T) {
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		t.Skip("test must not be run from a terminal")
+	}
+
+	c, err := New("echo hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.RunInteractive(nil)
+	if !errors.Is(err, ErrNotTerminal) {
+		t.Fatalf("TestRunInteractiveNotTerminal: got err == %v, want ErrNotTerminal", err)
+	}
+	if out.ExitCode != -1 {
+		t.Errorf("TestRunInteractiveNotTerminal: got ExitCode == %d, want -1", out.ExitCode)
+	}
+}
@@ -0,0 +1,11 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+)
+
+// RunInteractive is not supported on Windows.
+func (c *Cmd) RunInteractive(transcript io.Writer) (Output, error) {
+	return Output{ExitCode: -1}, errors.New("running a command interactively is not supported on Windows")
+}
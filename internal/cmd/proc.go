@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcGroup starts "c" in its own process group, so that killProc also kills the processes it starts, such as
+// the commands run by "sh -c", which would otherwise keep our pipes open.
+func setProcGroup(c *exec.Cmd) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	c.SysProcAttr.Setpgid = true
+}
+
+// killProc kills the process group that setProcGroup gave "c".
+func killProc(c *exec.Cmd) {
+	if err := syscall.Kill(-c.Process.Pid, syscall.SIGKILL); err != nil {
+		c.Process.Kill()
+	}
+}
@@ -0,0 +1,13 @@
+package cmd
+
+import (
+	"os/exec"
+)
+
+// setProcGroup does nothing on Windows.
+func setProcGroup(c *exec.Cmd) {}
+
+// killProc kills "c". The processes it started are not killed on Windows.
+func killProc(c *exec.Cmd) {
+	c.Process.Kill()
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/element-of-surprise/runme/internal/parser"
+)
+
+// shells are the shells that NewShell supports and the args used to run a script with them.
+var shells = map[string][]string{
+	"bash": {"bash", "-o", "pipefail", "-c"},
+	"sh":   {"sh", "-c"},
+}
+
+// shellFuncs are the functions that can be used in a template run by NewShell.
+var shellFuncs = template.FuncMap{
+	// quote is added to the end of every action that outputs a value.
+	"quote": Quote,
+	// raw outputs a value without quoting it.
+	"raw": func(v interface{}) string { return fmt.Sprint(v) },
+	// args outputs a list as separate quoted words.
+	"args": func(v interface{}) (string, error) {
+		list, err := parser.List(v)
+		if err != nil {
+			return "", fmt.Errorf("args: %w", err)
+		}
+		for i := range list {
+			list[i] = Quote(list[i])
+		}
+		return strings.Join(list, " "), nil
+	},
+}
+
+// NewShell creates a Cmd that runs the script "s" with "shell", which must be "bash" or "sh". "s" is a text/template
+// that is executed with "data", usually the map of our vals. Every value output by a template action is quoted so the
+// shell sees it as a single word and does not expand it. This means an action should not be placed inside quotes in
+// the script. Use {{ raw .Key }} to output a value without quoting or {{ args .List }} to output a list as separate
+// words.
+// Bash is run with pipefail set.
+func NewShell(shell, s string, data interface{}) (*Cmd, error) {
+	run, ok := shells[shell]
+	if !ok {
+		return nil, fmt.Errorf("shell(%s) is not supported, must be bash or sh", shell)
+	}
+
+	tmpl, err := template.New("").Funcs(shellFuncs).Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("command(%s) violated a text/template rule: %s", s, err)
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			endActions(t.Tree, t.Tree.Root, "quote", "raw", "args")
+		}
+	}
+	b := strings.Builder{}
+	if err := tmpl.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("command(%s): problem with template execution: %s", s, err)
+	}
+
+	args := append([]string{}, run...)
+	args = append(args, b.String())
+	return newCmd(args), nil
+}
+
+// endActions adds the function "fn" to the end of the pipeline of every action in "n" that outputs a value,
+// unless the pipeline already ends with "fn" or one of "ends".
+func endActions(tree *parse.Tree, n parse.Node, fn string, ends ...string) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			endActions(tree, c, fn, ends...)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) > 0 || len(n.Pipe.Cmds) == 0 {
+			return
+		}
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if id, ok := last.Args[0].(*parse.IdentifierNode); ok {
+			if id.Ident == fn {
+				return
+			}
+			for _, e := range ends {
+				if id.Ident == e {
+					return
+				}
+			}
+		}
+		n.Pipe.Cmds = append(
+			n.Pipe.Cmds,
+			&parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier(fn).SetTree(tree).SetPos(n.Pos)},
+			},
+		)
+	case *parse.IfNode:
+		endActions(tree, n.List, fn, ends...)
+		endActions(tree, n.ElseList, fn, ends...)
+	case *parse.RangeNode:
+		endActions(tree, n.List, fn, ends...)
+		endActions(tree, n.ElseList, fn, ends...)
+	case *parse.WithNode:
+		endActions(tree, n.List, fn, ends...)
+		endActions(tree, n.ElseList, fn, ends...)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build go1.20
+// +build go1.20
+
+package cmd
+
+import (
+	"os/exec"
+	"time"
+)
+
+// waitDelay is how long Wait waits for the output of a killed command after it exits.
+const waitDelay = time.Second
+
+// setWaitDelay stops Wait on "c" from waiting forever for output that a process it started still holds open.
+func setWaitDelay(c *exec.Cmd) {
+	c.WaitDelay = waitDelay
+}
@@ -0,0 +1,12 @@
+//go:build !go1.20
+// +build !go1.20
+
+package cmd
+
+import (
+	"os/exec"
+)
+
+// setWaitDelay does nothing before Go 1.20, which added exec.Cmd.WaitDelay. killProc killing the process group
+// is what closes our pipes.
+func setWaitDelay(c *exec.Cmd) {}
@@ -0,0 +1,146 @@
+// Package jsonpath provides a small subset of JSONPath for getting a single value out of a JSON document.
+// A path is an optional "$" followed by fields and indexes, such as "$.properties.principalId" or "items[0].name".
+// A field with characters other than letters, digits, "_" and "-" can be written as ["field name"].
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// step is a single step of a Path, which is either a field of an object or an index of an array.
+type step struct {
+	field string
+	index int
+	isIdx bool
+}
+
+func (s step) String() string {
+	if s.isIdx {
+		return fmt.Sprintf("[%d]", s.index)
+	}
+	return "." + s.field
+}
+
+// Path is a parsed path.
+type Path struct {
+	path  string
+	steps []step
+}
+
+// Parse parses "path".
+func Parse(path string) (Path, error) {
+	p := Path{path: path}
+	s := strings.TrimSpace(path)
+	s = strings.TrimPrefix(s, "$")
+
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '.':
+			i++
+			j := i
+			for j < len(s) && isFieldChar(s[j]) {
+				j++
+			}
+			if j == i {
+				return Path{}, fmt.Errorf("path(%s) has an empty field at position %d", path, i)
+			}
+			p.steps = append(p.steps, step{field: s[i:j]})
+			i = j
+		case '[':
+			end := strings.Index(s[i:], "]")
+			if end == -1 {
+				return Path{}, fmt.Errorf("path(%s) has a [ without a ]", path)
+			}
+			inner := strings.TrimSpace(s[i+1 : i+end])
+			switch {
+			case len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0]:
+				p.steps = append(p.steps, step{field: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil || n < 0 {
+					return Path{}, fmt.Errorf("path(%s) has an index(%s) that is not a positive number or quoted field", path, inner)
+				}
+				p.steps = append(p.steps, step{index: n, isIdx: true})
+			}
+			i += end + 1
+		default:
+			// A path can start with a field without a ".", such as "items[0]".
+			if i != 0 || !isFieldChar(s[i]) {
+				return Path{}, fmt.Errorf("path(%s) has an unexpected character(%c) at position %d", path, s[i], i)
+			}
+			s = "." + s
+		}
+	}
+	return p, nil
+}
+
+func isFieldChar(c byte) bool {
+	return c == '_' || c == '-' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// String returns the path as it was given to Parse.
+func (p Path) String() string {
+	return p.path
+}
+
+// Get returns the value at the path in the JSON document "doc".
+func (p Path) Get(doc []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil, fmt.Errorf("output is not JSON: %s", err)
+	}
+
+	at := "$"
+	for _, s := range p.steps {
+		switch {
+		case s.isIdx:
+			l, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not an array", at)
+			}
+			if s.index >= len(l) {
+				return nil, fmt.Errorf("%s has no index %d, it has length %d", at, s.index, len(l))
+			}
+			v = l[s.index]
+		default:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not an object", at)
+			}
+			v, ok = m[s.field]
+			if !ok {
+				return nil, fmt.Errorf("%s has no field %q", at, s.field)
+			}
+		}
+		at += s.String()
+	}
+	return v, nil
+}
+
+// GetString returns the value at the path in the JSON document "doc" as a string. See String.
+func (p Path) GetString(doc []byte) (string, error) {
+	v, err := p.Get(doc)
+	if err != nil {
+		return "", err
+	}
+	return String(v), nil
+}
+
+// String returns the JSON value "v" as a string. A string is returned as is, a null is "" and any other
+// value is encoded as JSON.
+func String(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case nil:
+		return ""
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,58 @@
+package jsonpath
+
+import (
+	"testing"
+)
+
+func TestGetString(t *testing.T) {
+	doc := []byte(`{"properties": {"principalId": "abc", "count": 3, "tags": {"a b": true}}, "items": [{"name": "x"}, {"name": "y"}], "none": null}`)
+
+	tests := []struct {
+		path     string
+		want     string
+		parseErr bool
+		getErr   bool
+	}{
+		{path: "$.properties.principalId", want: "abc"},
+		{path: "properties.count", want: "3"},
+		{path: `$.properties.tags["a b"]`, want: "true"},
+		{path: "$.items[1].name", want: "y"},
+		{path: "items[0]", want: `{"name":"x"}`},
+		{path: "$.none", want: ""},
+		{path: "$.items[2]", getErr: true},
+		{path: "$.properties.missing", getErr: true},
+		{path: "$.items.name", getErr: true},
+		{path: "$.items[a]", parseErr: true},
+		{path: "$..name", parseErr: true},
+		{path: "$.items[0", parseErr: true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.path)
+		switch {
+		case err == nil && test.parseErr:
+			t.Errorf("TestGetString(%s): got Parse err == nil, want err != nil", test.path)
+			continue
+		case err != nil && !test.parseErr:
+			t.Errorf("TestGetString(%s): got Parse err == %s, want err == nil", test.path, err)
+			continue
+		case err != nil:
+			continue
+		}
+
+		got, err := p.GetString(doc)
+		switch {
+		case err == nil && test.getErr:
+			t.Errorf("TestGetString(%s): got err == nil, want err != nil", test.path)
+			continue
+		case err != nil && !test.getErr:
+			t.Errorf("TestGetString(%s): got err == %s, want err == nil", test.path, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if got != test.want {
+			t.Errorf("TestGetString(%s): got %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -3,12 +3,21 @@
 // from a controlled environment, as I did not attempt to prevent the myriad of possible injection attacks I'm sure can occur.
 // This is for DevOps use where we are reading in files controlled by the engineers and peer reviewed, not for taking from some
 // random user.
+//
+// Words are split following the POSIX shell rules for quoting (but no expansion of any kind):
+//   - Unquoted whitespace separates words.
+//   - Outside of quotes, a backslash preserves the next character. A backslash followed by a newline is removed.
+//   - Inside single quotes, every character is preserved until the closing single quote.
+//   - Inside double quotes, a backslash only escapes $, `, ", \ and newline. Otherwise it is preserved.
+//   - Quoted and unquoted segments next to each other are joined into one word, so --opt='x y' is
+//     the single word --opt=x y. An empty pair of quotes is an empty word.
+//
+// In addition, text/template actions ({{ }}) outside of single quotes are kept whole and unchanged, including
+// any spaces or quotes inside them.
 package lexer
 
 import (
 	"fmt"
-	"io"
-	//"log"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -34,12 +43,67 @@ const (
 	ItemEOL
 )
 
+// eof is returned by next() and peek() when there is no more input.
+const eof rune = -1
+
 // Item describes a lexed item.
 type Item struct {
 	// Type is the type of item.
 	Type ItemType
-	// Value is the value.
+	// Value is the value with quotes and escapes removed.
 	Value string
+	// Raw is the text of the word as it appeared in the input.
+	Raw string
+	// Pos is the column (starting at 1) in the input where the word or error starts.
+	Pos int
+	// Parts are the parts of Value, split into text and template actions. Joining the Parts gives Value.
+	Parts []Part
+	// Quoted is true if any part of the word was quoted.
+	Quoted bool
+}
+
+// Part is part of a word.
+type Part struct {
+	// Text is the text of the part.
+	Text string
+	// Action indicates that Text is a text/template action ({{ }}). Otherwise Text is plain text,
+	// even if it contains {{.
+	Action bool
+}
+
+// wordBuilder collects the Parts of a word.
+type wordBuilder struct {
+	parts []Part
+	b     strings.Builder
+}
+
+// WriteRune writes a rune of text.
+func (w *wordBuilder) WriteRune(r rune) {
+	w.b.WriteRune(r)
+}
+
+// action adds a template action.
+func (w *wordBuilder) action(s string) {
+	w.flush()
+	w.parts = append(w.parts, Part{Text: s, Action: true})
+}
+
+// flush adds any text that has been written as a Part.
+func (w *wordBuilder) flush() {
+	if w.b.Len() > 0 {
+		w.parts = append(w.parts, Part{Text: w.b.String()})
+		w.b.Reset()
+	}
+}
+
+// String returns the value of the word.
+func (w *wordBuilder) String() string {
+	w.flush()
+	s := strings.Builder{}
+	for _, p := range w.parts {
+		s.WriteString(p.Text)
+	}
+	return s.String()
 }
 
 // Line is a line lexer targeted at command line arguments.
@@ -56,20 +120,21 @@ func New() *Line {
 	return &Line{}
 }
 
-// Parse parses our line into Item(s) and emits them on the returned channel.
+// Parse parses our line into Item(s) and emits them on the returned channel. If there is an error,
+// an ItemErr is the last Item sent.
 func (l *Line) Parse(s string) chan Item {
-	l.pos, l.width, l.input = 0, 0, strings.TrimSpace(s)
+	l.pos, l.width, l.input = 0, 0, s
 	l.ch = make(chan Item, 1)
 
 	go func() {
 		defer close(l.ch)
 		for {
 			l.skipSpaces()
-			if err := l.parseString(); err != nil {
-				if err == io.EOF {
-					return
-				}
-				l.ch <- Item{Type: ItemErr, Value: err.Error()}
+			if l.peek() == eof {
+				return
+			}
+			if err := l.parseWord(); err != nil {
+				l.ch <- Item{Type: ItemErr, Value: err.Error(), Pos: err.(posError).pos}
 				return
 			}
 		}
@@ -77,127 +142,186 @@ func (l *Line) Parse(s string) chan Item {
 	return l.ch
 }
 
-// parseStrings the next string.
-func (l *Line) parseString() error {
-	raw := strings.Builder{}
+// posError is an error at a column in the input.
+type posError struct {
+	pos int
+	msg string
+}
 
-	var r rune
-	for ; true; r = l.next() {
+func (p posError) Error() string {
+	return fmt.Sprintf("col %d: %s", p.pos, p.msg)
+}
+
+// errorf returns a posError at byte offset "offset" of our input.
+func (l *Line) errorf(offset int, format string, a ...interface{}) error {
+	return posError{pos: l.col(offset), msg: fmt.Sprintf(format, a...)}
+}
+
+// col converts a byte offset in our input to a column, counted in runes starting at 1.
+func (l *Line) col(offset int) int {
+	return utf8.RuneCountInString(l.input[:offset]) + 1
+}
+
+// parseWord parses the next word, which ends at unquoted whitespace or the end of input.
+func (l *Line) parseWord() error {
+	start := l.pos
+	val := &wordBuilder{}
+	// quoted records if any part of the word was quoted, which makes an empty word valid.
+	quoted := false
+
+	for {
+		r := l.next()
 		switch {
-		case string(r) == `'` || string(r) == `"`:
+		case r == eof:
+			l.emit(start, val, quoted)
+			return nil
+		case unicode.IsSpace(r):
 			l.backup()
-			s, err := l.untilClose()
-			if err != nil {
+			l.emit(start, val, quoted)
+			return nil
+		case r == '\'':
+			quoted = true
+			if err := l.singleQuote(val); err != nil {
 				return err
 			}
-			raw.WriteString(s)
-			l.emit(raw.String())
-			return nil
-		case string(r) == `{` && string(l.peek()) == `{`:
+		case r == '"':
+			quoted = true
+			if err := l.doubleQuote(val); err != nil {
+				return err
+			}
+		case r == '\\':
+			p := l.next()
+			switch p {
+			case eof:
+				return l.errorf(l.pos-1, "backslash at the end of the line escapes nothing")
+			case '\n':
+				// Line continuation, which is removed.
+			default:
+				val.WriteRune(p)
+			}
+		case r == '{' && l.peek() == '{':
 			l.backup()
 			s, err := l.mustache()
 			if err != nil {
 				return err
 			}
-			//log.Printf("I see: %q", s)
-			raw.WriteString(s)
-		case unicode.IsSpace(r):
-			if raw.Len() > 0 {
-				l.emit(raw.String())
-			}
-			return nil
-		case r == rune(ItemEOL):
-			l.emit(raw.String())
-			return io.EOF
-		case r == '\x00':
-			continue
+			val.action(s)
 		default:
-			raw.WriteRune(r)
+			val.WriteRune(r)
 		}
 	}
-	panic("should never get here")
 }
 
-// emit emits an Item from the string.
-func (l *Line) emit(s string) {
-	//log.Printf("emit: %q", s)
-	if strings.TrimSpace(s) == "" {
-		return
-	}
-	switch {
-	case strings.HasPrefix(s, "-") || strings.HasPrefix(s, "--"):
-		if strings.Contains(s, "=") {
-			l.ch <- Item{Type: ItemFlagAndValue, Value: s}
-			return
+// singleQuote is called after an opening ' and writes all characters until the closing ' to "val".
+func (l *Line) singleQuote(val *wordBuilder) error {
+	open := l.pos - 1
+	for {
+		r := l.next()
+		switch r {
+		case eof:
+			return l.errorf(open, "open single quote(') was never closed")
+		case '\'':
+			return nil
+		default:
+			val.WriteRune(r)
 		}
-		l.ch <- Item{Type: ItemFlag, Value: s}
-		return
 	}
-	l.ch <- Item{Type: ItemWord, Value: s}
 }
 
-// untilClose is used when the next character is ", ', or {{  and then gathers all characters until the closing quote is seen.
-// The next character after the quote must be a EOL or space.
-func (l *Line) untilClose() (string, error) {
-	raw := strings.Builder{}
-	quote := l.next()
-
-	switch quote {
-	case '"', '\'':
-		raw.WriteRune(quote)
-	default:
-		return "", fmt.Errorf("open quote was not one we support(%q)", string(quote))
-	}
-
+// doubleQuote is called after an opening " and writes all characters until the closing " to "val",
+// handling escapes and templates.
+func (l *Line) doubleQuote(val *wordBuilder) error {
+	open := l.pos - 1
 	for {
 		r := l.next()
 		switch {
-		case r == quote:
-			p := l.peek()
-			if !unicode.IsSpace(p) && p != rune(ItemEOL) {
-				return "", fmt.Errorf("open quote(%s) was not met with a closed quote followed by a space or EOL", string(quote))
+		case r == eof:
+			return l.errorf(open, `open double quote(") was never closed`)
+		case r == '"':
+			return nil
+		case r == '\\':
+			p := l.next()
+			switch p {
+			case eof:
+				return l.errorf(open, `open double quote(") was never closed`)
+			case '$', '`', '"', '\\':
+				val.WriteRune(p)
+			case '\n':
+				// Line continuation, which is removed.
+			default:
+				val.WriteRune('\\')
+				val.WriteRune(p)
 			}
-			raw.WriteRune(quote)
-			return raw.String(), nil
-		case r == rune(ItemEOL):
-			return "", fmt.Errorf("open quote(%s) was never closed", string(quote))
+		case r == '{' && l.peek() == '{':
+			l.backup()
+			s, err := l.mustache()
+			if err != nil {
+				return err
+			}
+			val.action(s)
 		default:
-			raw.WriteRune(r)
+			val.WriteRune(r)
 		}
 	}
 }
 
+// emit emits an Item for the word "w" that started at byte offset "start".
+// Empty words are only emitted if they were quoted.
+func (l *Line) emit(start int, w *wordBuilder, quoted bool) {
+	s := w.String()
+	if s == "" && !quoted {
+		return
+	}
+	item := Item{
+		Type:   ItemWord,
+		Value:  s,
+		Raw:    l.input[start:l.pos],
+		Pos:    l.col(start),
+		Parts:  w.parts,
+		Quoted: quoted,
+	}
+	if strings.HasPrefix(s, "-") {
+		item.Type = ItemFlag
+		if strings.Contains(s, "=") {
+			item.Type = ItemFlagAndValue
+		}
+	}
+	l.ch <- item
+}
+
 // mustache is used when the next characters are {{ and then gathers all characters until the closing }} is seen.
+// Quotes inside the template are kept as is, so a }} inside a quoted string does not close it.
 func (l *Line) mustache() (string, error) {
-	raw := strings.Builder{}
-	left := l.next()
-
-	switch {
-	case left == '{':
-		if l.peek() != '{' {
-			return "", fmt.Errorf("bug: open quote for mustache({{) was missing second bracket")
-		}
-		l.next()
-		raw.WriteString(`{{`)
-	default:
-		return "", fmt.Errorf("bug: mustache()was called when there was no mustache {{")
+	open := l.pos
+	if l.next() != '{' || l.next() != '{' {
+		return "", l.errorf(open, "bug: mustache() was called when there was no mustache {{")
 	}
+	raw := strings.Builder{}
+	raw.WriteString("{{")
 
+	var quote rune
 	for {
 		r := l.next()
 		switch {
-		case r == '}':
-			p := l.peek()
-			if p != '}' {
-				raw.WriteRune(r)
-				continue
+		case r == eof:
+			return "", l.errorf(open, "open mustache({{) was never closed")
+		case quote != 0:
+			raw.WriteRune(r)
+			switch {
+			case r == '\\' && quote == '"':
+				if p := l.next(); p != eof {
+					raw.WriteRune(p)
+				}
+			case r == quote:
+				quote = 0
 			}
+		case r == '"' || r == '`' || r == '\'':
+			quote = r
+			raw.WriteRune(r)
+		case r == '}' && l.peek() == '}':
 			l.next()
 			raw.WriteString("}}")
-
 			return raw.String(), nil
-		case r == rune(ItemEOL):
-			return "", fmt.Errorf("open mustache {{ was never closed")
 		default:
 			raw.WriteRune(r)
 		}
@@ -208,7 +332,7 @@ func (l *Line) mustache() (string, error) {
 func (l *Line) skipSpaces() {
 	for {
 		r := l.peek()
-		if unicode.IsSpace(r) {
+		if r != eof && unicode.IsSpace(r) {
 			l.next()
 			continue
 		}
@@ -216,7 +340,7 @@ func (l *Line) skipSpaces() {
 	}
 }
 
-// backup goes back a character.
+// backup goes back a character. This can only be called once per call to next().
 func (l *Line) backup() {
 	l.pos -= l.width
 }
@@ -225,7 +349,7 @@ func (l *Line) backup() {
 func (l *Line) next() rune {
 	if l.pos >= len(l.input) {
 		l.width = 0
-		return rune(ItemEOL)
+		return eof
 	}
 	var r rune
 	r, l.width = utf8.DecodeRuneInString(l.input[l.pos:])
@@ -233,12 +357,11 @@ func (l *Line) next() rune {
 	return r
 }
 
-// Peek returns but does not consume the next rune in the input.
+// peek returns but does not consume the next rune in the input.
 func (l *Line) peek() rune {
 	if l.pos >= len(l.input) {
-		return rune(ItemEOL)
+		return eof
 	}
-	r := l.next()
-	l.backup()
+	r, _ := utf8.DecodeRuneInString(l.input[l.pos:])
 	return r
 }
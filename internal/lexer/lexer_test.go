@@ -6,102 +6,418 @@ import (
 	"github.com/kylelemons/godebug/pretty"
 )
 
+// These are helpers for building the Items we want. Raw, Pos, Parts and Quoted are checked in
+// TestRawAndPos and TestParts.
+func word(s string) Item    { return Item{Type: ItemWord, Value: s} }
+func flag(s string) Item    { return Item{Type: ItemFlag, Value: s} }
+func flagVal(s string) Item { return Item{Type: ItemFlagAndValue, Value: s} }
+
+// lex returns all the Items for "line".
+func lex(line string) []Item {
+	got := []Item{}
+	for item := range New().Parse(line) {
+		got = append(got, item)
+	}
+	return got
+}
+
 func TestLine(t *testing.T) {
 	tests := []struct {
 		desc string
 		line string
 		want []Item
 	}{
+		{
+			desc: "Empty line",
+			line: "",
+			want: []Item{},
+		},
+		{
+			desc: "Only spaces",
+			line: " \t  ",
+			want: []Item{},
+		},
+		{
+			desc: "Leading, trailing and repeated spaces",
+			line: "  az   login\t--use-device-code  ",
+			want: []Item{word("az"), word("login"), flag("--use-device-code")},
+		},
 		{
 			desc: "Line with double quotes",
 			line: `az role assignment create --role "Managed Identity Operator" --assignee 63af9c3f-7503-4026-85b0-0b7a97f578f8 --scope /subscriptions/b0901439-755b-40bb-a7b0-672b3h76727a/resourceGroups/westus2`,
 			want: []Item{
-				{ItemWord, "az"},
-				{ItemWord, "role"},
-				{ItemWord, "assignment"},
-				{ItemWord, "create"},
-				{ItemFlag, "--role"},
-				{ItemWord, `"Managed Identity Operator"`},
-				{ItemFlag, "--assignee"},
-				{ItemWord, "63af9c3f-7503-4026-85b0-0b7a97f578f8"},
-				{ItemFlag, "--scope"},
-				{ItemWord, "/subscriptions/b0901439-755b-40bb-a7b0-672b3h76727a/resourceGroups/westus2"},
+				word("az"),
+				word("role"),
+				word("assignment"),
+				word("create"),
+				flag("--role"),
+				word("Managed Identity Operator"),
+				flag("--assignee"),
+				word("63af9c3f-7503-4026-85b0-0b7a97f578f8"),
+				flag("--scope"),
+				word("/subscriptions/b0901439-755b-40bb-a7b0-672b3h76727a/resourceGroups/westus2"),
 			},
 		},
 		{
 			desc: "Line with {{ }}",
 			line: `az aks create --name kube_{{.Region}} --resource-group {{ .KubeName }} --os-sku CBLMariner --max-pods 250 --network-plugin azure --vnet-subnet-id /subscriptions/{{ .Subscription }}/resourceGroups/{{ .Region }}/providers/Microsoft.Network/virtualNetworks/{{ .KubeName }}/subnets/default --docker-bridge-address 172.17.0.1/16 --service-cidr 10.2.0.0/24 --enable-managed-identity`,
 			want: []Item{
-				{ItemWord, "az"},
-				{ItemWord, "aks"},
-				{ItemWord, "create"},
-				{ItemFlag, "--name"},
-				{ItemWord, "kube_{{.Region}}"},
-				{ItemFlag, "--resource-group"},
-				{ItemWord, "{{ .KubeName }}"},
-				{ItemFlag, "--os-sku"},
-				{ItemWord, "CBLMariner"},
-				{ItemFlag, "--max-pods"},
-				{ItemWord, "250"},
-				{ItemFlag, "--network-plugin"},
-				{ItemWord, "azure"},
-				{ItemFlag, "--vnet-subnet-id"},
-				{ItemWord, "/subscriptions/{{ .Subscription }}/resourceGroups/{{ .Region }}/providers/Microsoft.Network/virtualNetworks/{{ .KubeName }}/subnets/default"},
-				{ItemFlag, "--docker-bridge-address"},
-				{ItemWord, "172.17.0.1/16"},
-				{ItemFlag, "--service-cidr"},
-				{ItemWord, "10.2.0.0/24"},
-				{ItemFlag, "--enable-managed-identity"},
+				word("az"),
+				word("aks"),
+				word("create"),
+				flag("--name"),
+				word("kube_{{.Region}}"),
+				flag("--resource-group"),
+				word("{{ .KubeName }}"),
+				flag("--os-sku"),
+				word("CBLMariner"),
+				flag("--max-pods"),
+				word("250"),
+				flag("--network-plugin"),
+				word("azure"),
+				flag("--vnet-subnet-id"),
+				word("/subscriptions/{{ .Subscription }}/resourceGroups/{{ .Region }}/providers/Microsoft.Network/virtualNetworks/{{ .KubeName }}/subnets/default"),
+				flag("--docker-bridge-address"),
+				word("172.17.0.1/16"),
+				flag("--service-cidr"),
+				word("10.2.0.0/24"),
+				flag("--enable-managed-identity"),
 			},
 		},
+		{
+			desc: "Single quotes",
+			line: `echo 'hello world'`,
+			want: []Item{word("echo"), word("hello world")},
+		},
+		{
+			desc: "Single quotes preserve backslashes and double quotes",
+			line: `echo 'a\b "c"'`,
+			want: []Item{word("echo"), word(`a\b "c"`)},
+		},
+		{
+			desc: "Double quotes preserve single quotes",
+			line: `echo "it's"`,
+			want: []Item{word("echo"), word("it's")},
+		},
+		{
+			desc: "Double quoted segment joined to unquoted segment",
+			line: `az --query "a b"c`,
+			want: []Item{word("az"), flag("--query"), word("a bc")},
+		},
+		{
+			desc: "Unquoted segment joined to double quoted segment",
+			line: `echo a"b c"`,
+			want: []Item{word("echo"), word("ab c")},
+		},
+		{
+			desc: "Quote in the middle of a flag",
+			line: `cmd --opt='x y'`,
+			want: []Item{word("cmd"), flagVal("--opt=x y")},
+		},
+		{
+			desc: "Double quote in the middle of a flag",
+			line: `cmd --opt="x y" --other`,
+			want: []Item{word("cmd"), flagVal("--opt=x y"), flag("--other")},
+		},
+		{
+			desc: "Adjacent single and double quoted segments",
+			line: `echo 'a b'"c d"'e'`,
+			want: []Item{word("echo"), word("a bc de")},
+		},
+		{
+			desc: "Escaped space",
+			line: `ls foo\ bar`,
+			want: []Item{word("ls"), word("foo bar")},
+		},
+		{
+			desc: "Escaped quotes outside of quotes",
+			line: `echo \"hi\" \'there\'`,
+			want: []Item{word("echo"), word(`"hi"`), word(`'there'`)},
+		},
+		{
+			desc: "Escaped backslash",
+			line: `echo a\\b`,
+			want: []Item{word("echo"), word(`a\b`)},
+		},
+		{
+			desc: "Escaped normal character",
+			line: `echo \a`,
+			want: []Item{word("echo"), word("a")},
+		},
+		{
+			desc: "Escaped double quote inside double quotes",
+			line: `echo "say \"hi\""`,
+			want: []Item{word("echo"), word(`say "hi"`)},
+		},
+		{
+			desc: "Escaped backslash and dollar inside double quotes",
+			line: `echo "a\\b \$HOME"`,
+			want: []Item{word("echo"), word(`a\b $HOME`)},
+		},
+		{
+			desc: "Backslash before a normal character inside double quotes is kept",
+			line: `echo "a\nb"`,
+			want: []Item{word("echo"), word(`a\nb`)},
+		},
+		{
+			desc: "Line continuation outside of quotes",
+			line: "echo a\\\nb",
+			want: []Item{word("echo"), word("ab")},
+		},
+		{
+			desc: "Line continuation inside double quotes",
+			line: "echo \"a\\\nb\"",
+			want: []Item{word("echo"), word("ab")},
+		},
+		{
+			desc: "Newline inside single quotes is kept",
+			line: "echo 'a\nb'",
+			want: []Item{word("echo"), word("a\nb")},
+		},
+		{
+			desc: "Newlines separate words",
+			line: "echo\na\nb",
+			want: []Item{word("echo"), word("a"), word("b")},
+		},
+		{
+			desc: "Empty double quotes",
+			line: `echo "" b`,
+			want: []Item{word("echo"), word(""), word("b")},
+		},
+		{
+			desc: "Empty single quotes at end of line",
+			line: `echo ''`,
+			want: []Item{word("echo"), word("")},
+		},
+		{
+			desc: "Empty quotes joined to a word",
+			line: `echo a""b`,
+			want: []Item{word("echo"), word("ab")},
+		},
+		{
+			desc: "Quoted dash is still a flag",
+			line: `cmd "--name"`,
+			want: []Item{word("cmd"), flag("--name")},
+		},
+		{
+			desc: "Single dash flag",
+			line: `az aks show -g group -otsv`,
+			want: []Item{word("az"), word("aks"), word("show"), flag("-g"), word("group"), flag("-otsv")},
+		},
+		{
+			desc: "Flag with value",
+			line: `cmd --name=value -n=1`,
+			want: []Item{word("cmd"), flagVal("--name=value"), flagVal("-n=1")},
+		},
+		{
+			desc: "Equals sign in a word is not a flag",
+			line: `env A=B`,
+			want: []Item{word("env"), word("A=B")},
+		},
+		{
+			desc: "Template with spaces is one word",
+			line: `echo {{ printf "%s %s" .A .B }}`,
+			want: []Item{word("echo"), word(`{{ printf "%s %s" .A .B }}`)},
+		},
+		{
+			desc: "Template with }} in a string",
+			line: `echo {{ printf "}}" }}`,
+			want: []Item{word("echo"), word(`{{ printf "}}" }}`)},
+		},
+		{
+			desc: "Template with a raw string",
+			line: "echo {{ printf `a b` }}",
+			want: []Item{word("echo"), word("{{ printf `a b` }}")},
+		},
+		{
+			desc: "Template inside double quotes",
+			line: `echo "value: {{ .A }}"`,
+			want: []Item{word("echo"), word("value: {{ .A }}")},
+		},
+		{
+			desc: "Template with quotes inside double quotes",
+			line: `echo "{{ printf "%s" .A }} done"`,
+			want: []Item{word("echo"), word(`{{ printf "%s" .A }} done`)},
+		},
+		{
+			desc: "Template inside single quotes is only text",
+			line: `echo '{{ "a'`,
+			want: []Item{word("echo"), word(`{{ "a`)},
+		},
+		{
+			desc: "Templates joined in a flag",
+			line: `az --scope=/subscriptions/{{ .Subscription }}/resourcegroups/{{ .MCResc }}`,
+			want: []Item{word("az"), flagVal("--scope=/subscriptions/{{ .Subscription }}/resourcegroups/{{ .MCResc }}")},
+		},
+		{
+			desc: "Single brace is text",
+			line: `echo {a} }`,
+			want: []Item{word("echo"), word("{a}"), word("}")},
+		},
+		{
+			desc: "Unicode",
+			line: `echo "héllo wörld" ünïcode`,
+			want: []Item{word("echo"), word("héllo wörld"), word("ünïcode")},
+		},
+		{
+			desc: "Quoted JSON",
+			line: `az rest --body '{"a": [1, 2]}'`,
+			want: []Item{word("az"), word("rest"), flag("--body"), word(`{"a": [1, 2]}`)},
+		},
+		{
+			desc: "JMESPath query",
+			line: `az vm list --query "[?name=='vm1'].id" -otsv`,
+			want: []Item{word("az"), word("vm"), word("list"), flag("--query"), word("[?name=='vm1'].id"), flag("-otsv")},
+		},
 	}
 
-	l := New()
 	for _, test := range tests {
-		ch := l.Parse(test.line)
-		got := []Item{}
-		for item := range ch {
-			got = append(got, item)
+		got := lex(test.line)
+		for i := range got {
+			got[i].Raw = ""
+			got[i].Pos = 0
+			got[i].Parts = nil
+			got[i].Quoted = false
 		}
 		if diff := pretty.Compare(test.want, got); diff != "" {
-			t.Errorf("TestLine(%s): -want/+got:\n", diff)
+			t.Errorf("TestLine(%s): -want/+got:\n%s", test.desc, diff)
 		}
 	}
 }
 
-/*
-"az aks create --name kube_{{.Region}} --resource-group {{ .KubeName }} --os-sku CBLMariner --max-pods 250 --network-plugin azure --vnet-subnet-id /subscriptions/{{ .Subscription }}/resourceGroups/{{ .Region }}/providers/Microsoft.Network/virtualNetworks/{{ .KubeName }}/subnets/default --docker-bridge-address 172.17.0.1/16 --service-cidr 10.2.0.0/24 --enable-managed-identity"
-*/
+func TestRawAndPos(t *testing.T) {
+	got := lex(`az  --query "a b"c 'x'{{ .Y }} ü\ v`)
+	want := []Item{
+		{Type: ItemWord, Value: "az", Raw: "az", Pos: 1},
+		{Type: ItemFlag, Value: "--query", Raw: "--query", Pos: 5},
+		{Type: ItemWord, Value: "a bc", Raw: `"a b"c`, Pos: 13},
+		{Type: ItemWord, Value: "x{{ .Y }}", Raw: `'x'{{ .Y }}`, Pos: 20},
+		{Type: ItemWord, Value: "ü v", Raw: `ü\ v`, Pos: 32},
+	}
+	for i := range got {
+		got[i].Parts = nil
+		got[i].Quoted = false
+	}
+	if diff := pretty.Compare(want, got); diff != "" {
+		t.Errorf("TestRawAndPos: -want/+got:\n%s", diff)
+	}
+}
+
+func TestParts(t *testing.T) {
+	tests := []struct {
+		desc       string
+		line       string
+		wantParts  []Part
+		wantQuoted bool
+	}{
+		{
+			desc:      "Text",
+			line:      `hello`,
+			wantParts: []Part{{Text: "hello"}},
+		},
+		{
+			desc: "Text and actions",
+			line: `/subs/{{ .Sub }}/groups/{{ .Group }}`,
+			wantParts: []Part{
+				{Text: "/subs/"},
+				{Text: "{{ .Sub }}", Action: true},
+				{Text: "/groups/"},
+				{Text: "{{ .Group }}", Action: true},
+			},
+		},
+		{
+			desc: "Quoted text and action",
+			line: `"a b {{ .C }}"`,
+			wantParts: []Part{
+				{Text: "a b "},
+				{Text: "{{ .C }}", Action: true},
+			},
+			wantQuoted: true,
+		},
+		{
+			desc:       "Single quoted mustache is text",
+			line:       `'{{ .C }}'`,
+			wantParts:  []Part{{Text: "{{ .C }}"}},
+			wantQuoted: true,
+		},
+		{
+			desc:       "Empty quotes",
+			line:       `""`,
+			wantQuoted: true,
+		},
+	}
+
+	for _, test := range tests {
+		got := lex(test.line)
+		if len(got) != 1 {
+			t.Errorf("TestParts(%s): got %d Items, want 1", test.desc, len(got))
+			continue
+		}
+		if diff := pretty.Compare(test.wantParts, got[0].Parts); diff != "" {
+			t.Errorf("TestParts(%s): -want/+got:\n%s", test.desc, diff)
+		}
+		if got[0].Quoted != test.wantQuoted {
+			t.Errorf("TestParts(%s): got Quoted == %v, want %v", test.desc, got[0].Quoted, test.wantQuoted)
+		}
+	}
+}
 
-/*
-func TestUntilClose(t *testing.T) {
+func TestLineErrors(t *testing.T) {
 	tests := []struct {
 		desc string
 		line string
-		want string
+		want Item
 	}{
 		{
-			desc: "Mustache {{ }}",
-			line: `{{ .Hello }} my baby`,
-			want: `{{ .Hello }}`,
+			desc: "Unclosed double quote",
+			line: `az --query "a b`,
+			want: Item{Type: ItemErr, Value: `col 12: open double quote(") was never closed`, Pos: 12},
+		},
+		{
+			desc: "Unclosed single quote",
+			line: `echo 'abc`,
+			want: Item{Type: ItemErr, Value: `col 6: open single quote(') was never closed`, Pos: 6},
+		},
+		{
+			desc: "Unclosed single quote after a word",
+			line: `echo abc'def`,
+			want: Item{Type: ItemErr, Value: `col 9: open single quote(') was never closed`, Pos: 9},
+		},
+		{
+			desc: "Escaped closing double quote",
+			line: `echo "abc\"`,
+			want: Item{Type: ItemErr, Value: `col 6: open double quote(") was never closed`, Pos: 6},
 		},
 		{
-			desc: "Mustache with no spaces",
-			line: `{{.VnetInfo}}`,
-			want: `{{.VnetInfo}}`,
+			desc: "Unclosed template",
+			line: `echo {{ .A`,
+			want: Item{Type: ItemErr, Value: `col 6: open mustache({{) was never closed`, Pos: 6},
+		},
+		{
+			desc: "Unclosed template inside double quotes",
+			line: `echo "{{ .A"`,
+			want: Item{Type: ItemErr, Value: `col 7: open mustache({{) was never closed`, Pos: 7},
+		},
+		{
+			desc: "Trailing backslash",
+			line: `echo abc\`,
+			want: Item{Type: ItemErr, Value: `col 9: backslash at the end of the line escapes nothing`, Pos: 9},
+		},
+		{
+			desc: "Position counts runes",
+			line: `echo ü 'abc`,
+			want: Item{Type: ItemErr, Value: `col 8: open single quote(') was never closed`, Pos: 8},
 		},
 	}
 
-	l := New()
 	for _, test := range tests {
-		l.pos, l.width, l.input = 0, 0, strings.TrimSpace(test.line)
-		got, err := l.untilClose()
-		if err != nil {
-			panic(err)
+		got := lex(test.line)
+		if len(got) == 0 {
+			t.Errorf("TestLineErrors(%s): got no Items", test.desc)
+			continue
 		}
-		if diff := pretty.Compare(test.want, got); diff != "" {
-			t.Errorf("TestUntilClose(%s): -want/+got:\n%s", test.desc, diff)
+		if diff := pretty.Compare(test.want, got[len(got)-1]); diff != "" {
+			t.Errorf("TestLineErrors(%s): -want/+got:\n%s", test.desc, diff)
 		}
 	}
 }
-*/
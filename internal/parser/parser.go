@@ -1,39 +1,223 @@
 // Package parser provides a line parser that takes strings representing
 // commands and turns them into a list of args. It does not attempt to do things like
 // shell interpretation, simply a straight conversion.
+//
+// Lines may also contain text/template actions. Template converts a line into a single template
+// where each word is kept apart, so that after execution Split can recover the args. A value substituted
+// by a template always stays inside the arg it was substituted into, even if it contains spaces. Only the
+// "args" function in Funcs can turn a value into more than one arg. A value with a NUL or \x01 character,
+// which Split uses to find args, fails the template instead.
 package parser
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
 
 	"github.com/element-of-surprise/runme/internal/lexer"
 )
 
+const (
+	// argSep separates args in the output of a template made by Template. A NUL can never be
+	// part of an arg passed to a program, so it cannot be confused with a value.
+	argSep = "\x00"
+	// keepMark marks an arg that must be kept even if it is empty, such as a quoted word.
+	keepMark = "\x01"
+)
+
+// Funcs are the functions that can be used in a template made by Template.
+var Funcs = template.FuncMap{
+	"args": args,
+	// value must be added to the end of every action that outputs a value, see ValueFunc.
+	ValueFunc: value,
+}
+
+// ValueFunc is the name of the function in Funcs that must end the pipeline of every action that outputs a
+// value, unless it ends with "args". It fails if the value has a character used by Split, which would change
+// how the value is split into args.
+const ValueFunc = "value"
+
 type Line struct {
 	text  string
 	lexer *lexer.Line
 }
 
 func (l *Line) Parse(s string) ([]string, error) {
+	items, err := l.items(s)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, len(items))
+	for _, item := range items {
+		args = append(args, item.Value)
+	}
+	return args, nil
+}
+
+// Stages splits the line "s" into the lines of a pipeline at each unquoted | word, which is how a pipeline is
+// shown. A | that is quoted or part of a larger word is not split on.
+func (l *Line) Stages(s string) ([]string, error) {
+	items, err := l.items(s)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := []string{}
+	words := []string{}
+	for _, item := range items {
+		if item.Raw == "|" {
+			if len(words) == 0 {
+				return nil, fmt.Errorf("pipeline stage(%d) is empty", len(stages))
+			}
+			stages = append(stages, strings.Join(words, " "))
+			words = nil
+			continue
+		}
+		words = append(words, item.Raw)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("pipeline stage(%d) is empty", len(stages))
+	}
+	return append(stages, strings.Join(words, " ")), nil
+}
+
+// Template returns the text/template source for the line "s". Template actions may span more
+// than one word, such as {{ if .Debug }}--verbose{{ end }}. The output of executing the template
+// must be given to Split to get the args.
+func (l *Line) Template(s string) (string, error) {
+	items, err := l.items(s)
+	if err != nil {
+		return "", err
+	}
+
+	b := strings.Builder{}
+	for i, item := range items {
+		if i > 0 {
+			b.WriteString(argSep)
+		}
+		if item.Quoted {
+			b.WriteString(keepMark)
+		}
+		for _, p := range item.Parts {
+			switch {
+			case p.Action:
+				b.WriteString(p.Text)
+			case strings.Contains(p.Text, "{{"):
+				// This was quoted or escaped text, so it must not be seen as an action.
+				b.WriteString("{{" + strconv.Quote(p.Text) + "}}")
+			default:
+				b.WriteString(p.Text)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// Split splits the output of executing a template made by Template into args. Empty args are
+// removed unless they came from a quoted word, the same as a shell does with an empty variable.
+func Split(out string) []string {
+	args := []string{}
+	for _, f := range strings.Split(out, argSep) {
+		keep := strings.Contains(f, keepMark)
+		f = strings.ReplaceAll(f, keepMark, "")
+		if f == "" && !keep {
+			continue
+		}
+		args = append(args, f)
+	}
+	return args
+}
+
+// args is a template function that splats a list into separate args. See List for the values that can be
+// used. Every element becomes an arg, even if it is empty.
+func args(v interface{}) (string, error) {
+	list, err := List(v)
+	if err != nil {
+		return "", fmt.Errorf("args: %w", err)
+	}
+	for _, e := range list {
+		if err := checkArg(e); err != nil {
+			return "", fmt.Errorf("args: %w", err)
+		}
+	}
+	if len(list) == 0 {
+		return "", nil
+	}
+	return keepMark + strings.Join(list, argSep+keepMark), nil
+}
+
+// value is ValueFunc. It outputs "v" the same way a template does.
+func value(v interface{}) (string, error) {
+	if v == nil {
+		return "<no value>", nil
+	}
+	s := fmt.Sprint(v)
+	if err := checkArg(s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// checkArg returns an error if "s" has a character that Split uses to find args.
+func checkArg(s string) error {
+	switch {
+	case strings.Contains(s, argSep):
+		return errors.New("an arg cannot contain a NUL character")
+	case strings.Contains(s, keepMark):
+		return errors.New(`an arg cannot contain a \x01 character`)
+	}
+	return nil
+}
+
+// List converts "v" into a list of strings. "v" can be a []string, a []interface{} or a string.
+// A string that is a JSON array is decoded, any other string is split on whitespace.
+func List(v interface{}) ([]string, error) {
+	var list []string
+	switch t := v.(type) {
+	case []string:
+		list = t
+	case []interface{}:
+		for _, e := range t {
+			list = append(list, fmt.Sprint(e))
+		}
+	case string:
+		s := strings.TrimSpace(t)
+		if strings.HasPrefix(s, "[") {
+			var i []interface{}
+			if err := json.Unmarshal([]byte(s), &i); err != nil {
+				return nil, fmt.Errorf("value looks like a JSON array but could not be decoded: %s", err)
+			}
+			return List(i)
+		}
+		list = strings.Fields(s)
+	default:
+		return nil, fmt.Errorf("cannot make a list from type %T", v)
+	}
+	return list, nil
+}
+
+// items returns the lexed words of "s".
+func (l *Line) items(s string) ([]lexer.Item, error) {
 	if l.lexer == nil {
 		l.lexer = lexer.New()
 	}
 	ch := l.lexer.Parse(s)
 
-	args := []string{}
-
+	items := []lexer.Item{}
 	for item := range ch {
 		switch item.Type {
 		case lexer.ItemErr:
 			return nil, errors.New(item.Value)
 		case lexer.ItemWord, lexer.ItemFlag, lexer.ItemFlagAndValue:
-			args = append(args, item.Value)
+			items = append(items, item)
 		}
 	}
-	if len(args) < 1 {
+	if len(items) < 1 {
 		return nil, fmt.Errorf("must have at least the program name")
 	}
-
-	return args, nil
+	return items, nil
 }
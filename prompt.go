@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/element-of-surprise/runme/config"
+	"golang.org/x/term"
+)
+
+// isTerminal returns true if our stdin is attached to a terminal.
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// prompter asks the user for values on the terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// terminal is set if "in" reads from a terminal, where secrets are read without being echoed.
+	terminal bool
+}
+
+func newPrompter() *prompter {
+	return &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout, terminal: isTerminal()}
+}
+
+// required prompts for each Required value in "reqs" and stores the answer in "vals". It will
+// re-prompt until the answer is valid.
+func (p *prompter) required(reqs []config.Required, vals map[string]string) error {
+	for _, req := range reqs {
+		v, err := p.value(req)
+		if err != nil {
+			return err
+		}
+		vals[req.Name] = v
+	}
+	return nil
+}
+
+// value prompts for a single Required value.
+func (p *prompter) value(req config.Required) (string, error) {
+	fmt.Fprintf(p.out, "\n%s is required\n", req.Name)
+	if req.Description != "" {
+		fmt.Fprintf(p.out, "\t%s\n", req.Description)
+	}
+	if req.Default != "" {
+		fmt.Fprintf(p.out, "\tdefault: %s\n", req.Default)
+	}
+	if req.Regex != "" {
+		fmt.Fprintf(p.out, "\tmust match: %s\n", req.Regex)
+	}
+
+	for {
+		fmt.Fprintf(p.out, "%s: ", req.Name)
+		v, err := p.read(req.Secret)
+		if err != nil {
+			return "", fmt.Errorf("problem reading value for %s: %w", req.Name, err)
+		}
+		if v == "" {
+			if req.Default == "" {
+				fmt.Fprintln(p.out, "a value is required")
+				continue
+			}
+			v = req.Default
+		}
+		if err := req.Validate(v); err != nil {
+			fmt.Fprintln(p.out, err)
+			continue
+		}
+		return v, nil
+	}
+}
+
+// undefined prompts for each variable in "keys", which maps the variable to the step that would have set it,
+// and stores the answer in "vals".
+func (p *prompter) undefined(keys map[string]string, vals map[string]string) error {
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(p.out, "\nSome steps that are not selected set variables that the selected steps use.")
+	for _, k := range names {
+		v, err := p.value(config.Required{Name: k, Description: fmt.Sprintf("set by step(%s), which is not selected", keys[k])})
+		if err != nil {
+			return err
+		}
+		vals[k] = v
+	}
+	return nil
+}
+
+// approve asks if the step "name" is approved. Only "y" or "yes" approves it.
+func (p *prompter) approve(name string) (bool, error) {
+	fmt.Fprintf(p.out, "Approve step(%s)? [y/N]: ", name)
+	v, err := p.read(false)
+	if err != nil {
+		return false, fmt.Errorf("problem reading approval for %s: %w", name, err)
+	}
+	switch strings.ToLower(v) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// read reads a line from the terminal. If secret is set, the input is not echoed. Input that was already read
+// into our buffer, or that is not from a terminal, is read from the buffer so that answers stay in order.
+func (p *prompter) read(secret bool) (string, error) {
+	if secret && p.terminal && p.in.Buffered() == 0 {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(p.out)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	s, err := p.in.ReadString('\n')
+	if err != nil && !(err == io.EOF && s != "") {
+		return "", err
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// printValsFile prints the content of a --vals-file that would repeat this run without prompting.
+// Secret values are left out, so they will still need to be passed or prompted for.
+func printValsFile(out io.Writer, reqs []config.Required, vals map[string]string) error {
+	m := map[string]string{}
+	secrets := []string{}
+	for _, req := range reqs {
+		if req.Secret {
+			secrets = append(secrets, req.Name)
+			continue
+		}
+		if v, ok := vals[req.Name]; ok {
+			m[req.Name] = v
+		}
+	}
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "\nTo repeat this run without prompting, save the following to a file and pass it with --vals-file:")
+	fmt.Fprintln(out, string(b))
+	if len(secrets) > 0 {
+		fmt.Fprintf(out, "Secret values were left out and must be passed with --vals or entered at the prompt: %s\n", strings.Join(secrets, ", "))
+	}
+	fmt.Fprintln(out)
+	return nil
+}
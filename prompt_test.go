@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/kylelemons/godebug/pretty"
+)
+
+func TestPrompterRequired(t *testing.T) {
+	reqs := []config.Required{
+		{Name: "Region"},
+		{Name: "Password", Secret: true},
+		{Name: "Size", Default: "small"},
+		{Name: "Token", Secret: true},
+	}
+	p := &prompter{
+		in:  bufio.NewReader(strings.NewReader("westus\npass\n\ntok")),
+		out: &bytes.Buffer{},
+	}
+
+	vals := map[string]string{}
+	if err := p.required(reqs, vals); err != nil {
+		t.Fatalf("TestPrompterRequired: got err == %s, want err == nil", err)
+	}
+	want := map[string]string{"Region": "westus", "Password": "pass", "Size": "small", "Token": "tok"}
+	if diff := pretty.Compare(want, vals); diff != "" {
+		t.Errorf("TestPrompterRequired: -want/+got:\n%s", diff)
+	}
+}
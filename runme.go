@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/fs"
@@ -16,21 +17,65 @@ import (
 )
 
 var (
-	conf     = flag.String("config", "", "The TOML configuration file.")
+	conf     = flag.String("config", "", "The configuration file. This can be TOML, YAML (.yaml or .yml) or JSON (.json).")
 	resume   = flag.String("resume", "", "The path to a resume file you wish to use to resume a failed run.")
 	valsJSON = flag.String("vals", "", "A JSON map of map[string]string used to insert values in templates.")
+	valsFile = flag.String("vals-file", "", "The path to a file holding a JSON map of map[string]string used to insert values in templates. Values in --vals override these.")
+	wsFlag   = flag.String("workspace", "", "The directory to use as the Workspace of this run. Defaults to a new directory named by the run ID in the temp directory.")
+	approve  = flag.String("approve", "", "A comma separated list of Approve steps that are approved without asking. Steps in a called config are named [Call name]/[step name].")
+
+	only  = flag.String("only", "", "A comma separated list of the steps or tags in Seqs to run. Other steps are skipped.")
+	skip  = flag.String("skip", "", "A comma separated list of the steps or tags in Seqs to skip.")
+	from  = flag.String("from", "", "The step or tag in Seqs to start at. Steps before it are skipped.")
+	until = flag.String("until", "", "The step or tag in Seqs to stop after. Steps after it are skipped.")
+
+	step = flag.Bool("step", false, "Pause before each step in Seqs to continue, skip, edit a variable or the command, or quit. Requires a terminal.")
+
+	failOnTolerated = flag.Bool("fail-on-tolerated", false, "Exit with code 3 if the run succeeded but a step with ContinueOnError failed.")
 )
 
 func main() {
+	rollback := false
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fmt":
+			os.Exit(fmtCmd(os.Args[2:]))
+		case "run":
+			// "run" is the default, so we just remove it.
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "rollback":
+			rollback = true
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		}
+	}
 	flag.Parse()
 
+	if rollback && *resume == "" {
+		fmt.Println("Error: rollback requires --resume with the resume file of the run to roll back")
+		os.Exit(1)
+	}
+
 	ofs, err := osfs.New()
 	if err != nil {
 		fmt.Printf("Error accessing OS filesystem: %s\n", err)
 		os.Exit(1)
 	}
 
+	// There is one prompter for the run, as each buffers what it reads from stdin.
+	prompt := newPrompter()
+
 	vals := map[string]string{}
+	if *valsFile != "" {
+		b, err := fs.ReadFile(ofs, *valsFile)
+		if err != nil {
+			fmt.Printf("Error opening vals file(%s): %s\n", *valsFile, err)
+			os.Exit(1)
+		}
+		if err := json.Unmarshal(b, &vals); err != nil {
+			fmt.Printf("Error unmarshalling vals file(%s) into our map: %s\n", *valsFile, err)
+			os.Exit(1)
+		}
+	}
 	if *valsJSON != "" {
 		if err := json.Unmarshal([]byte(*valsJSON), &vals); err != nil {
 			fmt.Printf("Errorf unmarshalling --vals into our map: %s\n", err)
@@ -38,13 +83,7 @@ func main() {
 		}
 	}
 
-	c, err := config.FromFile(ofs, *conf, vals)
-	if err != nil {
-		fmt.Printf("Error opening config file(%s): %s\n", *conf, err)
-		os.Exit(1)
-	}
-
-	startAt := ""
+	r := &resumeConf{}
 	if *resume != "" {
 		b, err := fs.ReadFile(ofs, *resume)
 		if err != nil {
@@ -52,7 +91,6 @@ func main() {
 			os.Exit(1)
 		}
 
-		r := &resumeConf{}
 		if err := json.Unmarshal(b, &r); err != nil {
 			fmt.Printf("Error unmarshalling resume file(%s): %s\n", *resume, err)
 			os.Exit(1)
@@ -61,50 +99,293 @@ func main() {
 			fmt.Printf("Error validating resume file(%s): %s\n", *resume, err)
 			os.Exit(1)
 		}
+	}
 
-		startAt = r.StartAt
-		if len(r.Vals) > 0 {
-			vals = r.Vals
-		}
+	if err := r.workspace(*wsFlag); err != nil {
+		fmt.Printf("Error: %s\n", err)
+		os.Exit(1)
 	}
+	vals[config.WorkspaceKey] = r.Workspace
+	fmt.Println("Workspace: ", r.Workspace)
 
-	e, err := exec.New(c.Sequences(), startAt, ofs, vals)
+	c, err := config.FromFile(ofs, *conf, vals)
 	if err != nil {
-		panic(err)
+		missing := &config.MissingError{}
+		if !errors.As(err, &missing) || !isTerminal() {
+			fmt.Printf("Error opening config file(%s): %s\n", *conf, err)
+			os.Exit(1)
+		}
+		if err := prompt.required(missing.Required, vals); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		c, err = config.FromFile(ofs, *conf, vals)
+		if err != nil {
+			fmt.Printf("Error opening config file(%s): %s\n", *conf, err)
+			os.Exit(1)
+		}
+		if err := printValsFile(os.Stdout, c.Required, vals); err != nil {
+			fmt.Printf("Error: could not print a vals file: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if len(r.Vals) > 0 {
+		vals = r.Vals
+		vals[config.WorkspaceKey] = r.Workspace
 	}
 
-	if err := e.Run(c, vals); err != nil {
-		fmt.Printf("Error: The program had a problem: %s\n", err)
+	if rollback {
+		os.Exit(rollbackCmd(ofs, c, vals, r))
+	}
 
-		r := &resumeConf{Vals: vals, StartAt: e.FailedNode()}
-		b, err := json.MarshalIndent(r, "", "\t")
-		if err != nil {
-			fmt.Printf("could not create a resume file: %s\n", err)
+	if sel := selection(); sel != nil {
+		r.Selection = sel
+	}
+	opts := []exec.Option{exec.WithApprover(approver(prompt, *approve))}
+	if r.Selection != nil {
+		opts = append(opts, exec.WithSelection(*r.Selection))
+	}
+	if *step {
+		if !isTerminal() {
+			fmt.Println("Error: --step must be run from a terminal")
 			os.Exit(1)
 		}
+		opts = append(opts, exec.WithStepper(stepper(prompt, c)))
+	}
+	e, err := exec.New(c.Sequences(), r.StartAt, ofs, vals, opts...)
+	if err != nil {
+		panic(err)
+	}
+	if err := e.CheckSelection(); err != nil {
+		undefined := &exec.UndefinedError{}
+		if !errors.As(err, &undefined) {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+		if !isTerminal() {
+			fmt.Printf("Error: %s\n", err)
+			fmt.Println("pass them with --vals or --vals-file, or run from a terminal to be asked for them")
+			os.Exit(1)
+		}
+		if err := prompt.undefined(undefined.Keys, vals); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-		var p string
-		if *resume == "" {
-			id := uuid.New().String()
-			p = filepath.Join(os.TempDir(), id+".resume.json")
-		} else {
-			p = filepath.Join(*resume)
+	err = e.Run(c, vals)
+	printReport(e.Outcomes())
+	tolerated := e.Tolerated()
+	printTolerated(tolerated)
+	if err != nil {
+		paused := errors.Is(err, exec.ErrNeedsApproval)
+		quit := errors.Is(err, exec.ErrQuit)
+		switch {
+		case paused:
+			fmt.Printf("The run stopped at step(%s), which needs approval\n", e.FailedNode())
+		case quit:
+			fmt.Printf("The run was quit at step(%s)\n", e.FailedNode())
+		default:
+			fmt.Printf("Error: The program had a problem: %s\n", err)
 		}
 
-		if err := os.WriteFile(p, b, 0660); err != nil {
-			fmt.Printf("problem writing resume file: %s\n", err)
+		r.Vals = vals
+		r.StartAt = e.FailedNode()
+		r.Completed = append(r.Completed, e.Completed()...)
+		p, err := r.write(*resume)
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
 			os.Exit(1)
 		}
 		fmt.Printf("your resume file ID is: %s\n", filepath.Base(p))
+		if paused {
+			fmt.Printf("to approve it and continue, run again with: --resume %s --approve %q\n", p, e.FailedNode())
+			os.Exit(2)
+		}
+		if quit {
+			fmt.Printf("to continue, run again with: --resume %s\n", p)
+		}
 		os.Exit(1)
 	}
 
+	if len(tolerated) > 0 && *failOnTolerated {
+		fmt.Println("program ended with tolerated failures")
+		os.Exit(3)
+	}
 	fmt.Println("program ended successfully")
 }
 
+// rollbackCmd runs the Undo of the completed steps in the resume file "r" in reverse order, and writes the steps
+// that could not be undone back to the resume file. It returns the exit code.
+func rollbackCmd(ofs exec.ReadWriter, c *config.Config, vals map[string]string, r *resumeConf) int {
+	if len(r.Completed) == 0 {
+		fmt.Println("there are no completed steps with an Undo to roll back")
+		return 0
+	}
+
+	e, err := exec.New(c.Sequences(), "", ofs, vals)
+	if err != nil {
+		panic(err)
+	}
+	remaining, err := e.Rollback(c, r.Completed)
+	printReport(e.Outcomes())
+
+	r.Completed = remaining
+	if _, werr := r.write(*resume); werr != nil {
+		fmt.Printf("Error: %s\n", werr)
+		return 1
+	}
+	if err != nil {
+		fmt.Printf("Error: rollback had a problem: %s\n", err)
+		fmt.Printf("the steps that were not undone are in resume file: %s\n", *resume)
+		return 1
+	}
+	fmt.Println("rollback ended successfully")
+	return 0
+}
+
+// approver returns the exec.Approver for our run. Steps in "approved", a comma separated list, are approved
+// without asking. Other steps are asked about on the terminal with "p", or stop the run if we are not on one.
+func approver(p *prompter, approved string) exec.Approver {
+	names := map[string]bool{}
+	for _, n := range list(approved) {
+		names[n] = true
+	}
+	return func(name, summary string) (bool, error) {
+		fmt.Printf("\n%s\n\n", summary)
+		if names[name] {
+			fmt.Printf("step(%s) was approved with --approve\n", name)
+			return true, nil
+		}
+		if !isTerminal() {
+			return false, exec.ErrNeedsApproval
+		}
+		return p.approve(name)
+	}
+}
+
+// selection returns the exec.Selection set by our flags, or nil if none were set.
+func selection() *exec.Selection {
+	s := &exec.Selection{Only: list(*only), Skip: list(*skip), From: strings.TrimSpace(*from), Until: strings.TrimSpace(*until)}
+	if s.Only == nil && s.Skip == nil && s.From == "" && s.Until == "" {
+		return nil
+	}
+	return s
+}
+
+// list splits the comma separated list "s" into its entries, leaving out empty ones.
+func list(s string) []string {
+	var l []string
+	for _, n := range strings.Split(s, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			l = append(l, n)
+		}
+	}
+	return l
+}
+
+// printReport prints the outcome of every step that was run.
+func printReport(outcomes []exec.Outcome) {
+	if len(outcomes) == 0 {
+		return
+	}
+	fmt.Println("Run report:")
+	for _, o := range outcomes {
+		status := "succeeded"
+		switch o.Status {
+		case exec.Failed:
+			status = "failed: " + o.Err.Error()
+		case exec.Tolerated:
+			status = "failed, tolerated: " + o.Err.Error()
+		case exec.Skipped:
+			status = "skipped"
+		case exec.Paused:
+			status = "paused: " + o.Err.Error()
+		}
+		fmt.Printf("\t%s: %s: %s\n", o.Stage, o.Name, status)
+	}
+}
+
+// printTolerated prints the steps that failed but had ContinueOnError set, so the run continued.
+func printTolerated(tolerated []exec.Outcome) {
+	if len(tolerated) == 0 {
+		return
+	}
+	fmt.Printf("%d step(s) failed with ContinueOnError set:\n", len(tolerated))
+	for _, o := range tolerated {
+		fmt.Printf("\t%s: %s\n", o.Name, o.Err)
+	}
+}
+
 type resumeConf struct {
-	Vals    map[string]string
-	StartAt string
+	// RunID is the ID of the run, which names the resume file and the default Workspace.
+	RunID string
+	// Workspace is the run's Workspace, which is kept when resuming.
+	Workspace string
+	Vals      map[string]string
+	StartAt   string
+	// Completed are the steps with an Undo that completed, which "runme rollback" undoes.
+	Completed []exec.Completed `json:",omitempty"`
+	// Selection is the selection of steps the run was started with, which a resumed run keeps unless
+	// it sets its own.
+	Selection *exec.Selection `json:",omitempty"`
+}
+
+// write writes the resume file to "p", or to a file named by the RunID in the temp directory if "p" is
+// not set. It returns the path written to.
+func (r *resumeConf) write(p string) (string, error) {
+	b, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return "", fmt.Errorf("could not create a resume file: %s", err)
+	}
+	if p == "" {
+		p = filepath.Join(os.TempDir(), r.RunID+".resume.json")
+	}
+	if err := os.WriteFile(p, b, 0660); err != nil {
+		return "", fmt.Errorf("problem writing resume file: %s", err)
+	}
+	return p, nil
+}
+
+// workspace sets the RunID and Workspace of a new run and creates the Workspace. "dir" is the Workspace
+// to use instead of the default. When resuming, the Workspace must still exist and "dir", if set, must be it.
+func (r *resumeConf) workspace(dir string) error {
+	if r.RunID == "" {
+		r.RunID = uuid.New().String()
+	}
+
+	switch {
+	case r.Workspace != "":
+		if _, err := os.Stat(r.Workspace); err != nil {
+			return fmt.Errorf("the Workspace(%s) of the run being resumed cannot be used: %s", r.Workspace, err)
+		}
+		if dir == "" {
+			return nil
+		}
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("the --workspace(%s) cannot be used: %s", dir, err)
+		}
+		if abs != r.Workspace {
+			return fmt.Errorf("the run being resumed used the Workspace(%s), which --workspace(%s) does not match", r.Workspace, dir)
+		}
+		return nil
+	case dir != "":
+		r.Workspace = dir
+	default:
+		r.Workspace = filepath.Join(os.TempDir(), "runme-"+r.RunID)
+	}
+
+	abs, err := filepath.Abs(r.Workspace)
+	if err != nil {
+		return fmt.Errorf("the Workspace(%s) cannot be used: %s", r.Workspace, err)
+	}
+	r.Workspace = abs
+	if err := os.MkdirAll(r.Workspace, 0700); err != nil {
+		return fmt.Errorf("could not create the Workspace(%s): %s", r.Workspace, err)
+	}
+	return nil
 }
 
 func (r *resumeConf) validate() error {
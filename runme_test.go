@@ -0,0 +1,64 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	saved := t.TempDir()
+	other := t.TempDir()
+
+	tests := []struct {
+		desc    string
+		r       resumeConf
+		dir     string
+		want    string
+		wantErr bool
+	}{
+		{
+			desc: "New run with --workspace",
+			dir:  filepath.Join(other, "ws"),
+			want: filepath.Join(other, "ws"),
+		},
+		{
+			desc: "Resume",
+			r:    resumeConf{RunID: "id", Workspace: saved},
+			want: saved,
+		},
+		{
+			desc: "Resume with the same --workspace",
+			r:    resumeConf{RunID: "id", Workspace: saved},
+			dir:  saved,
+			want: saved,
+		},
+		{
+			desc:    "Resume with a different --workspace",
+			r:       resumeConf{RunID: "id", Workspace: saved},
+			dir:     other,
+			wantErr: true,
+		},
+		{
+			desc:    "Resume after the Workspace was removed",
+			r:       resumeConf{RunID: "id", Workspace: filepath.Join(other, "missing")},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := test.r.workspace(test.dir)
+		switch {
+		case err == nil && test.wantErr:
+			t.Errorf("TestWorkspace(%s): got err == nil, want err != nil", test.desc)
+			continue
+		case err != nil && !test.wantErr:
+			t.Errorf("TestWorkspace(%s): got err == %s, want err == nil", test.desc, err)
+			continue
+		case err != nil:
+			continue
+		}
+		if test.r.Workspace != test.want {
+			t.Errorf("TestWorkspace(%s): got Workspace %q, want %q", test.desc, test.r.Workspace, test.want)
+		}
+	}
+}
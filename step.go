@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/element-of-surprise/runme/config"
+	"github.com/element-of-surprise/runme/exec"
+)
+
+// stepper returns the exec.Stepper for --step, which asks on the terminal with "p" what to do before each step is
+// run and after it fails. Secrets in "c" are redacted from what is shown.
+func stepper(p *prompter, c *config.Config) exec.Stepper {
+	return func(s *exec.Step) (exec.Action, error) {
+		return p.step(c, s)
+	}
+}
+
+// step shows the step "s" with the vals and asks what to do with it. Variables and the command can be changed
+// before deciding.
+func (p *prompter) step(c *config.Config, s *exec.Step) (exec.Action, error) {
+	edited := false
+	for {
+		if s.Err != nil {
+			fmt.Fprintf(p.out, "\nStep(%s) failed: %s\n", s.Name, c.Redact(s.Vals, s.Err.Error()))
+		} else {
+			fmt.Fprintf(p.out, "\nStep(%s)\n", s.Name)
+		}
+		if s.Cmd != "" {
+			fmt.Fprintf(p.out, "\tCmd: %s\n", c.Redact(s.Vals, s.Cmd))
+		}
+		keys := make([]string, 0, len(s.Vals))
+		for k := range s.Vals {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(p.out, "\tVals:")
+		for _, k := range keys {
+			v := s.Vals[k]
+			if c.IsSecret(k) {
+				v = "[redacted]"
+			}
+			fmt.Fprintf(p.out, "\t\t%s = %s\n", k, v)
+		}
+
+		if s.Err != nil {
+			fmt.Fprint(p.out, "[r]etry, [c]ontinue with the failure, [s]kip, edit a [v]ariable, [e]dit the command, [q]uit: ")
+		} else {
+			fmt.Fprint(p.out, "[c]ontinue, [s]kip, edit a [v]ariable, [e]dit the command, [q]uit: ")
+		}
+		choice, err := p.read(false)
+		if err != nil {
+			return exec.Quit, fmt.Errorf("problem reading what to do: %w", err)
+		}
+
+		switch strings.ToLower(choice) {
+		case "c", "continue":
+			return exec.Continue, nil
+		case "s", "skip":
+			return exec.Skip, nil
+		case "r", "retry":
+			return exec.Retry, nil
+		case "q", "quit":
+			return exec.Quit, nil
+		case "v", "variable":
+			if err := p.variable(c, s.Vals); err != nil {
+				return exec.Quit, err
+			}
+			if !edited {
+				s.Cmd = s.Render()
+			}
+		case "e", "edit":
+			fmt.Fprintln(p.out, "The command is for this attempt only. Secrets are shown as [redacted], use {{ .Key }} to put them back.")
+			fmt.Fprint(p.out, "Command (empty to keep it): ")
+			cmd, err := p.read(false)
+			if err != nil {
+				return exec.Quit, fmt.Errorf("problem reading the command: %w", err)
+			}
+			if cmd != "" {
+				s.Cmd = cmd
+				edited = true
+			}
+		default:
+			fmt.Fprintf(p.out, "%q is not a choice\n", choice)
+		}
+	}
+}
+
+// variable asks for the name and value of a variable and stores it in "vals".
+func (p *prompter) variable(c *config.Config, vals map[string]string) error {
+	fmt.Fprint(p.out, "Variable: ")
+	k, err := p.read(false)
+	if err != nil {
+		return fmt.Errorf("problem reading the variable: %w", err)
+	}
+	if k == "" {
+		return nil
+	}
+	fmt.Fprintf(p.out, "Value of %s: ", k)
+	v, err := p.read(c.IsSecret(k))
+	if err != nil {
+		return fmt.Errorf("problem reading the value of %s: %w", k, err)
+	}
+	vals[k] = v
+	return nil
+}